@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+var addAsTemplate bool
+
+var addCmd = &cobra.Command{
+	Use:   "add <file>",
+	Short: "adopt an existing config file into the template root",
+	Long: "copy a config file from the home dir into the template root, " +
+		"include it in the generate config and replace it with a link",
+	Args: cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		if err := checkLocalConfig(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		secrets, err := configuredSecrets()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		generator, err := configuredGenerator(secrets)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		templateName, err := generator.Add(
+			args[0],
+			addAsTemplate,
+			includeTemplate,
+		)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("added %s\n", templateName)
+	},
+}
+
+func init() {
+	addCmd.Flags().BoolVar(
+		&addAsTemplate,
+		"template",
+		false,
+		"add the file as a template, escaping any existing template actions",
+	)
+
+	rootCmd.AddCommand(addCmd)
+}
+
+// includeTemplate adds the template to generate.include in the config file
+// unless one of the existing include globs already matches it.
+func includeTemplate(templateName string) error {
+	roots := templateRoots()
+	templateRoot := roots[len(roots)-1]
+
+	relativeName, err := filepath.Rel(templateRoot, templateName)
+	if err != nil {
+		return err
+	}
+
+	for _, include := range viper.GetStringSlice(pathInclude) {
+		pattern := filepath.Join(templateRoot, include)
+		if match, _ := filepath.Match(pattern, templateName); match {
+			return nil
+		}
+	}
+
+	if err = appendConfigInclude(relativeName); err != nil {
+		return err
+	}
+
+	fmt.Printf("included %s in %s\n", relativeName, viper.ConfigFileUsed())
+
+	return nil
+}
+
+// appendConfigInclude adds include to the generate include globs of the
+// config file.
+func appendConfigInclude(include string) error {
+	return editConfig(func(root *yaml.Node) bool {
+		generateNode := mappingValue(root, "generate", yaml.MappingNode)
+		includeNode := mappingValue(generateNode, "include", yaml.SequenceNode)
+		appendSequence(includeNode, include)
+		return true
+	})
+}
+
+// editConfig edits the yaml node tree rather than writing back the viper
+// settings so comments and unrelated keys are kept as they are. The config is
+// only written when edit reports a change, which fails for a --from config.
+func editConfig(edit func(root *yaml.Node) (changed bool)) error {
+	configName := viper.ConfigFileUsed()
+
+	content, err := os.ReadFile(configName)
+	if err != nil {
+		return err
+	}
+
+	doc := &yaml.Node{}
+	if err = yaml.Unmarshal(content, doc); err != nil {
+		return err
+	}
+
+	if len(doc.Content) == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode}}
+	}
+
+	if !edit(doc.Content[0]) {
+		return nil
+	}
+
+	if err = checkLocalConfig(); err != nil {
+		return err
+	}
+
+	buffer := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buffer)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(doc); err != nil {
+		return err
+	}
+
+	return os.WriteFile(configName, buffer.Bytes(), 0o644)
+}
+
+// appendSequence appends a scalar to the node, turning a lone scalar into a
+// sequence first.
+func appendSequence(node *yaml.Node, value string) {
+	if node.Kind == yaml.ScalarNode {
+		node.Content = []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: node.Value},
+		}
+		node.Kind = yaml.SequenceNode
+		node.Tag = ""
+		node.Value = ""
+	}
+
+	node.Content = append(
+		node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: value},
+	)
+}
+
+// mappingValue finds the value of key in the mapping node, adding an empty
+// one of the kind when missing.
+func mappingValue(node *yaml.Node, key string, kind yaml.Kind) *yaml.Node {
+	if value := lookupMappingValue(node, key); value != nil {
+		return value
+	}
+
+	value := &yaml.Node{Kind: kind}
+	node.Content = append(
+		node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+		value,
+	)
+
+	return value
+}
+
+// lookupMappingValue finds the value of key in the mapping node, nil when
+// either is missing.
+func lookupMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// removeMappingKey removes key and its value from the mapping node, reporting
+// whether it was there.
+func removeMappingKey(node *yaml.Node, key string) bool {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return false
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return true
+		}
+	}
+
+	return false
+}
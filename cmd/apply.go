@@ -0,0 +1,516 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/yo3jones/yconfig/generate"
+	"github.com/yo3jones/yconfig/parse"
+	"github.com/yo3jones/yconfig/secret"
+	"github.com/yo3jones/yconfig/setup"
+)
+
+const (
+	pathApplyPhases string = "apply.phases"
+
+	phaseSetup    = "setup"
+	phaseGenerate = "generate"
+)
+
+var (
+	applyTags   []string
+	applyDryRun bool
+	applyOs     string
+	applyArch   string
+	applyBatch  bool
+)
+
+var phaseStyle = lipgloss.NewStyle().
+	MarginTop(1).
+	Bold(true)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "run setup and generate together",
+	Long: "run the setup entries and generate the config files in the " +
+		"configured phases with one tag set and one progress view",
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		apply()
+	},
+}
+
+func init() {
+	applyCmd.Flags().
+		StringSliceVar(&applyTags, "tag", []string{}, "tags used for filtering")
+	applyCmd.Flags().
+		BoolVar(
+			&applyDryRun,
+			"dry-run",
+			false,
+			"show what would run without changing anything",
+		)
+	applyCmd.Flags().
+		StringVar(&applyOs, "os", "", "apply as if running on this os")
+	applyCmd.Flags().
+		StringVar(&applyArch, "arch", "", "apply as if running on this arch")
+	applyCmd.Flags().
+		BoolVar(
+			&applyBatch,
+			"batch-packages",
+			false,
+			"install consecutive package entries in one invocation",
+		)
+
+	rootCmd.AddCommand(applyCmd)
+}
+
+// applyPhase is one step of apply. A setup phase runs the entries of the
+// given types or names that no earlier phase ran, all remaining entries when
+// neither is given.
+type applyPhase struct {
+	Name    string
+	Run     string
+	Types   []string
+	Entries []string
+}
+
+type applyPhaseStatus int
+
+const (
+	phaseWaiting applyPhaseStatus = iota
+	phaseRunning
+	phaseComplete
+	phaseError
+	phaseSkipped
+)
+
+func (s applyPhaseStatus) String() string {
+	switch s {
+	case phaseWaiting:
+		return "waiting"
+	case phaseRunning:
+		return "running"
+	case phaseComplete:
+		return "complete"
+	case phaseError:
+		return "error"
+	case phaseSkipped:
+		return "skipped"
+	}
+	return "unknown"
+}
+
+type applyPhaseState struct {
+	phase      *applyPhase
+	status     applyPhaseStatus
+	setupState *setup.SetupState
+	setupView  tea.Model
+	progress   *generate.Progress
+	err        error
+}
+
+type applyModel struct {
+	phases []*applyPhaseState
+	prompt *promptModel
+	done   bool
+}
+
+type applyStatusMsg struct {
+	i      int
+	status applyPhaseStatus
+	err    error
+}
+
+type applySetupMsg struct {
+	i     int
+	state *setup.SetupState
+}
+
+type applyProgressMsg struct {
+	i        int
+	progress *generate.Progress
+}
+
+// applyPhases reads the phases from the config, defaulting to setup followed
+// by generate. A phase is either the name of what it runs or a map.
+func applyPhases() (phases []*applyPhase, err error) {
+	raw := viper.Get(pathApplyPhases)
+	if raw == nil {
+		return []*applyPhase{
+			{Name: phaseSetup, Run: phaseSetup},
+			{Name: phaseGenerate, Run: phaseGenerate},
+		}, nil
+	}
+
+	var rawPhases *[]any
+	if rawPhases, err = parse.Cast[[]any](&raw); err != nil {
+		return nil, fmt.Errorf("%s must be a list", pathApplyPhases)
+	}
+
+	for _, rawPhase := range *rawPhases {
+		var phase *applyPhase
+		if phase, err = unmarshalApplyPhase(rawPhase); err != nil {
+			return nil, err
+		}
+		phases = append(phases, phase)
+	}
+
+	return phases, nil
+}
+
+func unmarshalApplyPhase(raw any) (phase *applyPhase, err error) {
+	phase = &applyPhase{}
+
+	switch raw := raw.(type) {
+	case string:
+		phase.Name, phase.Run = raw, raw
+	case map[string]any:
+		if phase.Run, _, err = parse.StringGet(&raw, "run"); err != nil {
+			return nil, err
+		}
+		if phase.Name, _, err = parse.StringGet(&raw, "name"); err != nil {
+			return nil, err
+		}
+		phase.Types, _, err = parse.StringSliceGet(&raw, "types")
+		if err != nil {
+			return nil, err
+		}
+		phase.Entries, _, err = parse.StringSliceGet(&raw, "entries")
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf(
+			"apply phase must be either a string or map[string]any but got %T",
+			raw,
+		)
+	}
+
+	if phase.Run == "" && (len(phase.Types) > 0 || len(phase.Entries) > 0) {
+		phase.Run = phaseSetup
+	}
+
+	if phase.Run != phaseSetup && phase.Run != phaseGenerate {
+		return nil, fmt.Errorf(
+			"apply phase %s must run either %s or %s",
+			phase.Name,
+			phaseSetup,
+			phaseGenerate,
+		)
+	}
+
+	if phase.Name == "" {
+		phase.Name = phase.Run
+	}
+
+	return phase, nil
+}
+
+func apply() {
+	phases, err := applyPhases()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	states := make([]*applyPhaseState, len(phases))
+	for i, phase := range phases {
+		states[i] = &applyPhaseState{phase: phase, setupView: setup.InitModel()}
+	}
+
+	tags := applyTagSet()
+
+	program := tea.NewProgram(applyModel{phases: states})
+	secretsTerminal = programTerminal(program)
+
+	secrets, err := configuredSecrets()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var applyErr error
+	failedEntries := 0
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+
+		ran := map[string]bool{}
+
+		for i, phase := range phases {
+			if applyErr != nil {
+				program.Send(applyStatusMsg{i: i, status: phaseSkipped})
+				continue
+			}
+
+			program.Send(applyStatusMsg{i: i, status: phaseRunning})
+
+			var (
+				failed int
+				err    error
+			)
+			switch phase.Run {
+			case phaseSetup:
+				failed, err = applySetup(i, phase, tags, ran, program, secrets)
+				failedEntries += failed
+			case phaseGenerate:
+				err = applyGenerate(i, tags, program, secrets)
+			}
+
+			if err != nil {
+				applyErr = err
+				program.Send(applyStatusMsg{i: i, status: phaseError, err: err})
+			} else {
+				program.Send(applyStatusMsg{i: i, status: phaseComplete})
+			}
+		}
+
+		var dm doneMsg = "done"
+		program.Send(dm)
+	}()
+
+	model, err := program.StartReturningModel()
+	if err != nil {
+		panic(err)
+	}
+
+	// quit before the phases finished
+	if !model.(applyModel).done {
+		os.Exit(1)
+	}
+
+	<-finished
+
+	if applyErr != nil {
+		fmt.Fprintln(os.Stderr, applyErr)
+		os.Exit(1)
+	}
+
+	if failedEntries > 0 {
+		fmt.Fprintf(os.Stderr, "%d setup entries failed\n", failedEntries)
+		os.Exit(1)
+	}
+}
+
+// applyTagSet is the tag set both phases run with, the tag flag or else the
+// generate tags of the config.
+func applyTagSet() []string {
+	if len(applyTags) > 0 {
+		return applyTags
+	}
+	return viper.GetStringSlice(pathTags)
+}
+
+// applySetup runs the entries the phase selects, returning how many of them
+// failed without stopping setup.
+func applySetup(
+	i int,
+	phase *applyPhase,
+	tags []string,
+	ran map[string]bool,
+	program *tea.Program,
+	secrets *secret.Secrets,
+) (failed int, err error) {
+	if !viper.IsSet("setup") {
+		program.Send(applySetupMsg{i: i, state: &setup.SetupState{}})
+		return 0, nil
+	}
+
+	scriptsConfig := viper.Get("scripts")
+	packageManagersConfig := viper.Get("packageManagers")
+	config := viper.Get("setup")
+
+	setuper := setup.New().
+		ScriptsConfig(&scriptsConfig).
+		PackageManagersConfig(&packageManagersConfig).
+		Config(&config).
+		Tags(tags).
+		Os(applyOs).
+		Arch(applyArch).
+		Dir(configFileDir()).
+		DryRun(applyDryRun).
+		Secrets(secrets).
+		Generator(func() (generate.Generator, error) {
+			return configuredGenerator(secrets)
+		}).
+		EntryNames(nil).
+		BatchPackages(applyBatch).
+		Filter(func(entry *setup.Entry) bool {
+			if ran[entry.Name] ||
+				!phaseSelects(phase.Types, entry.Type.String()) ||
+				!phaseSelects(phase.Entries, entry.Name) {
+				return false
+			}
+			ran[entry.Name] = true
+			return true
+		}).
+		HideCompletedOut(true).
+		OnProgress(func(state *setup.SetupState) {
+			failed = state.ErroredCount
+			program.Send(applySetupMsg{i: i, state: state})
+		})
+
+	err = setuper.Setup()
+
+	return failed, err
+}
+
+func phaseSelects(selected []string, value string) bool {
+	if len(selected) == 0 {
+		return true
+	}
+	for _, s := range selected {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
+
+func applyGenerate(
+	i int,
+	tags []string,
+	program *tea.Program,
+	secrets *secret.Secrets,
+) error {
+	generator, err := configuredGenerator(secrets)
+	if err != nil {
+		return err
+	}
+
+	generator.Os(applyOs).Arch(applyArch).Tags(tags)
+
+	if applyDryRun {
+		generator.DryRun(true)
+	}
+
+	return generator.
+		Prompter(programPrompter(program)).
+		OnProgress(func(progress *generate.Progress) {
+			program.Send(applyProgressMsg{i: i, progress: progress})
+		}).
+		Generate()
+}
+
+func (m applyModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m applyModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			if m.prompt != nil {
+				m.prompt.cancel()
+				m.prompt = nil
+			}
+			return m, tea.Quit
+		}
+		if m.prompt != nil {
+			answered, cmd := m.prompt.update(msg)
+			if answered {
+				m.prompt = nil
+			}
+			return m, cmd
+		}
+	case *promptMsg:
+		m.prompt = newPromptModel(msg)
+		return m, textinput.Blink
+	case applyStatusMsg:
+		m.phases[msg.i].status = msg.status
+		m.phases[msg.i].err = msg.err
+	case tea.WindowSizeMsg:
+		for _, phase := range m.phases {
+			phase.setupView.Update(msg)
+		}
+	case applySetupMsg:
+		m.phases[msg.i].setupState = msg.state
+		m.phases[msg.i].setupView.Update(msg.state)
+	case applyProgressMsg:
+		m.phases[msg.i].progress = msg.progress
+	case doneMsg:
+		m.done = true
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+func (m applyModel) View() string {
+	sb := strings.Builder{}
+
+	for _, phase := range m.phases {
+		sb.WriteString(phaseStyle.Render(fmt.Sprintf(
+			"%s (%s) %s",
+			phase.phase.Name,
+			phase.phase.Run,
+			phase.status,
+		)))
+		sb.WriteString("\n")
+
+		if phase.setupState != nil {
+			sb.WriteString(phase.setupView.View())
+		}
+
+		if phase.progress != nil {
+			sb.WriteString(renderTemplateRows(phase.progress))
+		}
+
+		if phase.err != nil && phase.setupState == nil &&
+			phase.progress == nil {
+			sb.WriteString(errorStyle.Render(phase.err.Error()))
+			sb.WriteString("\n")
+		}
+	}
+
+	if m.prompt != nil {
+		sb.WriteString(m.prompt.view())
+		sb.WriteString("\n")
+	}
+
+	if m.done {
+		sb.WriteString(m.renderSummary())
+	}
+
+	return sb.String()
+}
+
+func (m applyModel) renderSummary() string {
+	total, applied, errored := 0, 0, 0
+	failed := false
+
+	for _, phase := range m.phases {
+		if phase.setupState != nil {
+			total += len(phase.setupState.EntryStates)
+			applied += phase.setupState.AppliedCount()
+			errored += phase.setupState.ErroredCount
+		}
+		if phase.progress != nil {
+			total += len(phase.progress.TemplatesProgress)
+			applied += phase.progress.CompletedCount()
+			errored += phase.progress.ErroredCount()
+		}
+		failed = failed || phase.status == phaseError
+	}
+
+	style := summaryStyle.Copy().Foreground(lipgloss.Color("10"))
+	if failed || errored > 0 {
+		style.Foreground(lipgloss.Color("9"))
+	}
+
+	return style.Render(
+		fmt.Sprintf(
+			"%d of %d steps applied, %d failed",
+			applied,
+			total,
+			errored,
+		),
+	)
+}
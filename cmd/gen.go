@@ -1,36 +1,91 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"runtime"
 	"strings"
 
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/yo3jones/yconfig/generate"
+	"github.com/yo3jones/yconfig/secret"
+	"github.com/yo3jones/yconfig/set"
+	"github.com/yo3jones/yconfig/setup"
 )
 
 const (
-	nameTemplateRoot string = "template-root"
-	pathTempalteRoot string = "generate.templateRoot"
-	nameDestRoot     string = "destination-root"
-	pathDestRoot     string = "generate.destinationRoot"
-	nameInclude      string = "include"
-	pathInclude      string = "generate.include"
-	nameExclude      string = "exclude"
-	pathExclude      string = "generate.exclude"
-	nameLink         string = "link"
-	pathLink         string = "generate.link"
-	nameTags         string = "tag"
-	pathTags         string = "generate.tags"
-	nameDelay        string = "delay"
-	pathDelay        string = "generate.delay"
+	nameTemplateRoot  string = "template-root"
+	pathTempalteRoot  string = "generate.templateRoot"
+	nameTemplateRoots string = "template-roots"
+	pathTemplateRoots string = "generate.templateRoots"
+	nameDestRoot      string = "destination-root"
+	pathDestRoot      string = "generate.destinationRoot"
+	nameInclude       string = "include"
+	pathInclude       string = "generate.include"
+	nameExclude       string = "exclude"
+	pathExclude       string = "generate.exclude"
+	nameLink          string = "link"
+	pathLink          string = "generate.link"
+	nameTags          string = "tag"
+	pathTags          string = "generate.tags"
+	nameDelay         string = "delay"
+	pathDelay         string = "generate.delay"
+	nameSuffix        string = "template-suffix"
+	pathSuffix        string = "generate.templateSuffix"
+	pathDelims        string = "generate.delims"
+	pathMerge         string = "generate.merge"
+	pathBlocks        string = "generate.blocks"
+	pathOnChange      string = "generate.onChange"
+	nameStrict        string = "strict"
+	pathStrict        string = "generate.strict"
+	nameDryRun        string = "dry-run"
+	pathDryRun        string = "generate.dryRun"
+	nameOs            string = "os"
+	pathOs            string = "generate.os"
+	nameArch          string = "arch"
+	pathArch          string = "generate.arch"
+	nameParallel      string = "parallel"
+	pathParallel      string = "generate.parallel"
+	nameReprompt      string = "reprompt"
+	pathReprompt      string = "generate.reprompt"
+	pathAnswers       string = "generate.answersFile"
+
+	maxOutLines = 10
+)
+
+var (
+	errorStyle = lipgloss.NewStyle().
+			MarginLeft(5).
+			Border(lipgloss.NormalBorder(), false, false, false, true).
+			PaddingLeft(2).
+			BorderForeground(lipgloss.Color("9"))
+
+	outStyle = lipgloss.NewStyle().
+			MarginLeft(5).
+			Border(lipgloss.NormalBorder(), false, false, false, true).
+			PaddingLeft(2).
+			BorderForeground(lipgloss.Color("8"))
+
+	layerStyle = lipgloss.NewStyle().
+			Faint(true)
+
+	summaryStyle = lipgloss.NewStyle().
+			MarginTop(1).
+			PaddingLeft(3).
+			Bold(true)
 )
 
 type model struct {
+	verb     string
 	progress *generate.Progress
+	prompt   *promptModel
+	done     bool
 }
 
 type ProgressMsg struct {
@@ -44,41 +99,172 @@ var genCmd = &cobra.Command{
 	Short: "generate config files from templates",
 	Long:  "generate config files from templates",
 	Run: func(_ *cobra.Command, _ []string) {
-		templateRoot := viper.GetString(pathTempalteRoot)
-		destinationRoot := viper.GetString(pathDestRoot)
-		include := viper.GetStringSlice(pathInclude)
-		exclude := viper.GetStringSlice(pathExclude)
-		link := viper.GetBool(pathLink)
-		tags := viper.GetStringSlice(pathTags)
-		delay := viper.GetInt(pathDelay)
-
-		program := tea.NewProgram(model{})
-
-		go func() {
-			err := generate.New().
-				TemplateRoot(templateRoot).
-				DesinationRoot(destinationRoot).
-				Include(include).
-				Exclude(exclude).
-				Link(link).
-				Tags(tags).
+		runGenerator(generate.Generator.Generate, "generated")
+	},
+}
+
+// runGenerator runs the configured generator with the progress view, which
+// sums up the templates with verb.
+func runGenerator(
+	run func(generator generate.Generator) error,
+	verb string,
+) {
+	delay := viper.GetInt(pathDelay)
+
+	program := tea.NewProgram(model{verb: verb})
+	secretsTerminal = programTerminal(program)
+
+	secrets, err := configuredSecrets()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	generator, err := configuredGenerator(secrets)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	genErr := make(chan error, 1)
+
+	go func() {
+		genErr <- run(
+			generator.
 				Delay(delay).
+				Prompter(programPrompter(program)).
 				OnProgress(func(progress *generate.Progress) {
 					program.Send(ProgressMsg{progress})
-				}).
-				Generate()
-			if err != nil {
-				panic(err)
-			}
+				}),
+		)
 
-			var dm doneMsg = "done"
-			program.Send(dm)
-		}()
+		var dm doneMsg = "done"
+		program.Send(dm)
+	}()
 
-		if err := program.Start(); err != nil {
-			panic(err)
-		}
-	},
+	finalModel, err := program.StartReturningModel()
+	if err != nil {
+		panic(err)
+	}
+
+	// quit before the generator finished
+	if !finalModel.(model).done {
+		os.Exit(1)
+	}
+
+	if err = <-genErr; err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// templateRoots is the ordered list of template roots, falling back to the
+// single template root when no layers are configured.
+func templateRoots() []string {
+	roots := viper.GetStringSlice(pathTemplateRoots)
+	if len(roots) == 0 {
+		roots = []string{viper.GetString(pathTempalteRoot)}
+	}
+	for i, root := range roots {
+		roots[i] = configPath(root)
+	}
+	return roots
+}
+
+// configuredGenerator builds a generator from the generate section of the
+// config and the generate flags, looking up secrets with the given providers.
+func configuredGenerator(
+	secrets *secret.Secrets,
+) (generate.Generator, error) {
+	delims := []*generate.Delims{}
+	if err := viper.UnmarshalKey(pathDelims, &delims); err != nil {
+		return nil, err
+	}
+
+	merges := []*generate.Merge{}
+	if err := viper.UnmarshalKey(pathMerge, &merges); err != nil {
+		return nil, err
+	}
+
+	blocks := []*generate.Block{}
+	if err := viper.UnmarshalKey(pathBlocks, &blocks); err != nil {
+		return nil, err
+	}
+
+	onChange := []*generate.OnChange{}
+	if err := viper.UnmarshalKey(pathOnChange, &onChange); err != nil {
+		return nil, err
+	}
+
+	hookRunner, err := configuredHookRunner(onChange)
+	if err != nil {
+		return nil, err
+	}
+
+	return generate.New().
+		TemplateRoots(templateRoots()).
+		DesinationRoot(configPath(viper.GetString(pathDestRoot))).
+		Include(viper.GetStringSlice(pathInclude)).
+		Exclude(viper.GetStringSlice(pathExclude)).
+		Link(viper.GetBool(pathLink)).
+		Tags(viper.GetStringSlice(pathTags)).
+		Os(viper.GetString(pathOs)).
+		Arch(viper.GetString(pathArch)).
+		Strict(viper.GetBool(pathStrict)).
+		DryRun(viper.GetBool(pathDryRun)).
+		TemplateSuffix(viper.GetString(pathSuffix)).
+		Delims(delims).
+		Merges(merges).
+		Blocks(blocks).
+		OnChange(onChange).
+		HookRunner(hookRunner).
+		Secrets(secrets).
+		Decrypt(configuredDecrypt()).
+		Answers(answersName()).
+		Reprompt(viper.GetBool(pathReprompt)).
+		Parallel(viper.GetInt(pathParallel)), nil
+}
+
+// configuredHookRunner runs onChange hooks through the system script selected
+// for the os, arch and tags, the same way setup entries are run.
+func configuredHookRunner(
+	onChange []*generate.OnChange,
+) (generate.HookRunner, error) {
+	if len(onChange) == 0 {
+		return nil, nil
+	}
+
+	scriptsConfig := viper.Get("scripts")
+	if scriptsConfig == nil {
+		return nil, errors.New("onChange hooks require scripts in the config")
+	}
+
+	scripts, err := setup.UnmarshalSystemScripts(&scriptsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	script, err := setup.NewFilterer().
+		Os(viper.GetString(pathOs)).
+		Arch(viper.GetString(pathArch)).
+		Tags(set.New(lowerTags(viper.GetStringSlice(pathTags))...)).
+		FilterSystemScripts(scripts)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hookScript string, writer io.Writer) error {
+		cmd, args := script.BuildCommand(hookScript)
+		return setup.Exec(cmd, args, nil, configDir, writer)
+	}, nil
+}
+
+func lowerTags(tags []string) []string {
+	lowered := make([]string, len(tags))
+	for i, tag := range tags {
+		lowered[i] = strings.ToLower(tag)
+	}
+	return lowered
 }
 
 func init() {
@@ -94,6 +280,19 @@ func init() {
 		fmt.Fprintln(os.Stderr, err)
 	}
 
+	genCmd.Flags().StringSlice(
+		nameTemplateRoots,
+		[]string{},
+		"ordered template roots where later roots override earlier ones",
+	)
+	err = viper.BindPFlag(
+		pathTemplateRoots,
+		genCmd.Flags().Lookup(nameTemplateRoots),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
 	genCmd.Flags().String(
 		nameDestRoot,
 		".",
@@ -147,6 +346,70 @@ func init() {
 		fmt.Fprintln(os.Stderr, err)
 	}
 
+	genCmd.Flags().String(
+		nameSuffix,
+		"",
+		"only render templates ending with this suffix, copying the rest",
+	)
+	err = viper.BindPFlag(pathSuffix, genCmd.Flags().Lookup(nameSuffix))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	genCmd.Flags().Bool(
+		nameStrict,
+		false,
+		"fail templates that use missing map keys",
+	)
+	err = viper.BindPFlag(pathStrict, genCmd.Flags().Lookup(nameStrict))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	genCmd.Flags().Bool(
+		nameDryRun,
+		false,
+		"render the templates without writing or linking anything",
+	)
+	err = viper.BindPFlag(pathDryRun, genCmd.Flags().Lookup(nameDryRun))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	genCmd.Flags().
+		String(nameOs, "", "render the templates as if running on this os")
+	err = viper.BindPFlag(pathOs, genCmd.Flags().Lookup(nameOs))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	genCmd.Flags().
+		String(nameArch, "", "render the templates as if running on this arch")
+	err = viper.BindPFlag(pathArch, genCmd.Flags().Lookup(nameArch))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	genCmd.Flags().Int(
+		nameParallel,
+		runtime.NumCPU(),
+		"how many templates to generate at once",
+	)
+	err = viper.BindPFlag(pathParallel, genCmd.Flags().Lookup(nameParallel))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	genCmd.Flags().Bool(
+		nameReprompt,
+		false,
+		"ask the template prompts again, defaulting to the kept answers",
+	)
+	err = viper.BindPFlag(pathReprompt, genCmd.Flags().Lookup(nameReprompt))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
 	genCmd.Flags().
 		Int(nameDelay, 0, "add a delay in mils to see cool animations")
 	err = viper.BindPFlag(pathDelay, genCmd.Flags().Lookup(nameDelay))
@@ -165,17 +428,42 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		if msg.Type == tea.KeyCtrlC {
+			if m.prompt != nil {
+				m.prompt.cancel()
+				m.prompt = nil
+			}
 			return m, tea.Quit
 		}
+		if m.prompt != nil {
+			answered, cmd := m.prompt.update(msg)
+			if answered {
+				m.prompt = nil
+			}
+			return m, cmd
+		}
+	case *promptMsg:
+		m.prompt = newPromptModel(msg)
+		return m, textinput.Blink
 	case ProgressMsg:
 		m.progress = msg.progress
 		return m, nil
 	case doneMsg:
+		m.done = true
 		return m, tea.Quit
 	}
 	return m, nil
 }
 
+// tailLines keeps the last lines of hook output so a chatty hook doesn't push
+// the other templates off screen.
+func tailLines(out []byte, n int) string {
+	lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
 func maxWidth(x, y int) int {
 	if x > y {
 		return x
@@ -188,8 +476,27 @@ func (m model) View() string {
 		return "starting"
 	}
 
+	sb := strings.Builder{}
+
+	sb.WriteString(renderTemplateRows(m.progress))
+
+	if m.prompt != nil {
+		sb.WriteString(m.prompt.view())
+		sb.WriteString("\n")
+	}
+
+	if m.done {
+		sb.WriteString(m.renderSummary())
+	}
+
+	return sb.String()
+}
+
+// renderTemplateRows renders a status row per template, dimly followed by the
+// template root layer it comes from, along with any hook output and error.
+func renderTemplateRows(progress *generate.Progress) string {
 	maxPathWidth := 0
-	for _, p := range m.progress.TemplatesProgress {
+	for _, p := range progress.TemplatesProgress {
 		maxPathWidth = maxWidth(maxPathWidth, lipgloss.Width(p.Path))
 	}
 
@@ -197,14 +504,17 @@ func (m model) View() string {
 	bracketStyle := lipgloss.NewStyle().
 		Bold(true)
 
-	for _, p := range m.progress.TemplatesProgress {
+	for _, p := range progress.TemplatesProgress {
 		var symbol string
 		symbolStyle := lipgloss.NewStyle().Bold(true)
 		switch p.Status {
 		case generate.Waiting:
 			symbolStyle.Foreground(lipgloss.Color("13"))
 			symbol = ""
-		case generate.Generating, generate.Linking:
+		case generate.Generating,
+			generate.Linking,
+			generate.Unlinking,
+			generate.Hooking:
 			symbolStyle.Foreground(lipgloss.Color("12"))
 			symbol = "◯"
 		case generate.Complete:
@@ -218,7 +528,7 @@ func (m model) View() string {
 		}
 		sb.WriteString(
 			fmt.Sprintf(
-				"   %s %s %s %s   %s\n",
+				"   %s %s %s %s   %s %s\n",
 				bracketStyle.Render("["),
 				symbolStyle.Copy().
 					Width(10).
@@ -228,10 +538,43 @@ func (m model) View() string {
 				lipgloss.NewStyle().
 					Width(maxPathWidth).
 					Render(p.Path),
-				symbolStyle.Render(symbol),
+				symbolStyle.Copy().
+					Width(1).
+					Render(symbol),
+				layerStyle.Render(p.Root),
 			),
 		)
+
+		if len(p.Out) > 0 {
+			sb.WriteString(outStyle.Render(tailLines(p.Out, maxOutLines)))
+			sb.WriteString("\n")
+		}
+
+		if p.Err != nil {
+			sb.WriteString(errorStyle.Render(p.Err.Error()))
+			sb.WriteString("\n")
+		}
 	}
 
 	return sb.String()
 }
+
+func (m model) renderSummary() string {
+	total := len(m.progress.TemplatesProgress)
+	errored := m.progress.ErroredCount()
+
+	style := summaryStyle.Copy().Foreground(lipgloss.Color("10"))
+	if errored > 0 {
+		style.Foreground(lipgloss.Color("9"))
+	}
+
+	return style.Render(
+		fmt.Sprintf(
+			"%d of %d templates %s, %d failed",
+			m.progress.CompletedCount(),
+			total,
+			m.verb,
+			errored,
+		),
+	) + "\n"
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/yo3jones/yconfig/setup"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	importFormat  string
+	importManager string
+	importName    string
+	importPrint   bool
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "import a package manifest into the setup config",
+	Long: "read a Brewfile, a newline delimited package list or the output " +
+		"of dpkg --get-selections and add its packages to the setup config " +
+		"as a package entry",
+	Args: cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		importManifest(args[0])
+	},
+}
+
+// importEntry is a setup entry written for an imported manifest.
+type importEntry struct {
+	Name     string   `yaml:"name"`
+	Manager  string   `yaml:"manager,omitempty"`
+	Taps     []string `yaml:"taps,omitempty"`
+	Packages []any    `yaml:"packages,omitempty"`
+}
+
+type importPackage struct {
+	Name    string   `yaml:"name"`
+	Version string   `yaml:"version,omitempty"`
+	Flags   []string `yaml:"flags,omitempty,flow"`
+}
+
+func init() {
+	importCmd.Flags().StringVar(
+		&importFormat,
+		"format",
+		"",
+		"brewfile, list or dpkg, detected from the file when not given",
+	)
+	importCmd.Flags().StringVar(
+		&importManager,
+		"manager",
+		"",
+		"name of the package manager the entry installs with",
+	)
+	importCmd.Flags().StringVar(
+		&importName,
+		"name",
+		"",
+		"name of the setup entry, the file name when not given",
+	)
+	importCmd.Flags().BoolVar(
+		&importPrint,
+		"print",
+		false,
+		"print the setup entries instead of adding them to the config",
+	)
+
+	rootCmd.AddCommand(importCmd)
+}
+
+func importManifest(name string) {
+	manifest, err := setup.ReadPackageManifest(name, importFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	entries := importEntries(name, manifest)
+
+	if importPrint {
+		out, err := yaml.Marshal(entries)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+
+	if err = checkLocalConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err = appendConfigSetup(entries); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf(
+		"imported %d packages from %s into %s\n",
+		len(manifest.Packages),
+		name,
+		viper.ConfigFileUsed(),
+	)
+}
+
+// importEntries builds a package entry for the manifest, with the taps of a
+// Brewfile added by the tap script of its package manager.
+func importEntries(
+	name string,
+	manifest *setup.PackageManifest,
+) []*importEntry {
+	entryName := importName
+	if entryName == "" {
+		entryName = filepath.Base(name)
+	}
+
+	packages := make([]any, len(manifest.Packages))
+	for i, pkg := range manifest.Packages {
+		if pkg.Version == "" && len(pkg.Flags) == 0 {
+			packages[i] = pkg.Name
+			continue
+		}
+		packages[i] = &importPackage{
+			Name:    pkg.Name,
+			Version: pkg.Version,
+			Flags:   pkg.Flags,
+		}
+	}
+
+	return []*importEntry{{
+		Name:     entryName,
+		Manager:  importManager,
+		Taps:     manifest.Taps,
+		Packages: packages,
+	}}
+}
+
+// appendConfigSetup appends the entries to the setup list of the config file,
+// keeping comments and unrelated keys like appendConfigInclude.
+func appendConfigSetup(entries []*importEntry) error {
+	configName := viper.ConfigFileUsed()
+	if configName == "" {
+		return fmt.Errorf("no config file found to import into")
+	}
+
+	content, err := os.ReadFile(configName)
+	if err != nil {
+		return err
+	}
+
+	doc := &yaml.Node{}
+	if err = yaml.Unmarshal(content, doc); err != nil {
+		return err
+	}
+
+	if len(doc.Content) == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode}}
+	}
+
+	setupNode := mappingValue(doc.Content[0], "setup", yaml.SequenceNode)
+	for _, entry := range entries {
+		entryNode := &yaml.Node{}
+		if err = entryNode.Encode(entry); err != nil {
+			return err
+		}
+		setupNode.Content = append(setupNode.Content, entryNode)
+	}
+
+	buffer := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buffer)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(doc); err != nil {
+		return err
+	}
+
+	return os.WriteFile(configName, buffer.Bytes(), 0o644)
+}
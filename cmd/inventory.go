@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/yo3jones/yconfig/setup"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultManagerName = "default"
+
+var inventoryYaml bool
+
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "compare installed packages with the config",
+	Long: "list the packages the package managers report as explicitly " +
+		"installed but no selected package entry has, and the configured " +
+		"packages that aren't installed",
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		inventory()
+	},
+}
+
+// inventoryEntry is a setup entry for a package missing from the config.
+type inventoryEntry struct {
+	Name     string   `yaml:"name"`
+	Manager  string   `yaml:"manager"`
+	Packages []string `yaml:"packages,flow"`
+}
+
+func init() {
+	inventoryCmd.Flags().
+		StringSliceVar(&tags, "tag", []string{}, "tags used for filtering")
+	inventoryCmd.Flags().
+		StringVar(&setupOs, "os", "", "filter entries as if running on this os")
+	inventoryCmd.Flags().
+		StringVar(
+			&setupArch,
+			"arch",
+			"",
+			"filter entries as if running on this arch",
+		)
+	inventoryCmd.Flags().
+		BoolVar(
+			&inventoryYaml,
+			"yaml",
+			false,
+			"print setup entries for the packages missing from the config",
+		)
+
+	setupCmd.AddCommand(inventoryCmd)
+}
+
+func inventory() {
+	scriptsConfig := viper.Get("scripts")
+	packageManagersConfig := viper.Get("packageManagers")
+	config := viper.Get("setup")
+
+	inventories, err := setup.New().
+		ScriptsConfig(&scriptsConfig).
+		PackageManagersConfig(&packageManagersConfig).
+		Config(&config).
+		Tags(tags).
+		Os(setupOs).
+		Arch(setupArch).
+		Dir(configFileDir()).
+		EntryNames(nil).
+		Inventory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if inventoryYaml {
+		printInventoryYaml(inventories)
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "MANAGER\tPACKAGE\tMISSING FROM")
+	for _, inventory := range inventories {
+		manager := inventory.Manager
+		if manager == "" {
+			manager = defaultManagerName
+		}
+		for _, pkg := range inventory.MissingFromConfig {
+			fmt.Fprintf(writer, "%s\t%s\tconfig\n", manager, pkg)
+		}
+		for _, pkg := range inventory.MissingFromMachine {
+			fmt.Fprintf(writer, "%s\t%s\tmachine\n", manager, pkg)
+		}
+	}
+	writer.Flush()
+}
+
+// printInventoryYaml prints the packages missing from the config as setup
+// entries ready to paste into the config. Packages of the default package
+// manager are plain strings.
+func printInventoryYaml(inventories []*setup.Inventory) {
+	entries := []any{}
+	for _, inventory := range inventories {
+		for _, pkg := range inventory.MissingFromConfig {
+			if inventory.Manager == "" {
+				entries = append(entries, pkg)
+				continue
+			}
+			entries = append(entries, &inventoryEntry{
+				Name:     pkg,
+				Manager:  inventory.Manager,
+				Packages: []string{pkg},
+			})
+		}
+	}
+
+	if len(entries) == 0 {
+		return
+	}
+
+	out, err := yaml.Marshal(entries)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Stdout.Write(out)
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/yo3jones/yconfig/generate"
+	"github.com/yo3jones/yconfig/secret"
+)
+
+const (
+	nameLintOs      string = "os"
+	pathLintOs      string = "lint.os"
+	nameLintArch    string = "arch"
+	pathLintArch    string = "lint.arch"
+	nameLintTagSets string = "tag-set"
+	pathLintTagSets string = "lint.tagSets"
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "check that the config file templates render",
+	Long: "parse and render every included template in strict mode for " +
+		"each os, arch and tag set combination without writing anything",
+	Run: func(_ *cobra.Command, _ []string) {
+		problems, err := lint()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+
+		if len(problems) > 0 {
+			fmt.Fprintf(
+				os.Stderr,
+				"%d template problems found\n",
+				len(problems),
+			)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	var err error
+
+	lintCmd.Flags().StringSlice(
+		nameLintOs,
+		[]string{runtime.GOOS},
+		"operating systems to render the templates for",
+	)
+	err = viper.BindPFlag(pathLintOs, lintCmd.Flags().Lookup(nameLintOs))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	lintCmd.Flags().StringSlice(
+		nameLintArch,
+		[]string{runtime.GOARCH},
+		"architectures to render the templates for",
+	)
+	err = viper.BindPFlag(pathLintArch, lintCmd.Flags().Lookup(nameLintArch))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	lintCmd.Flags().StringArray(
+		nameLintTagSets,
+		[]string{},
+		"comma separated tags to render the templates with, may be repeated",
+	)
+	err = viper.BindPFlag(
+		pathLintTagSets,
+		lintCmd.Flags().Lookup(nameLintTagSets),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	rootCmd.AddCommand(lintCmd)
+}
+
+func lintTagSets() [][]string {
+	rawTagSets := viper.GetStringSlice(pathLintTagSets)
+	if len(rawTagSets) == 0 {
+		return [][]string{viper.GetStringSlice(pathTags)}
+	}
+
+	tagSets := make([][]string, len(rawTagSets))
+	for i, rawTagSet := range rawTagSets {
+		tagSets[i] = []string{}
+		for _, tag := range strings.Split(rawTagSet, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tagSets[i] = append(tagSets[i], tag)
+			}
+		}
+	}
+
+	return tagSets
+}
+
+// lint renders every template once per os, arch and tag set combination and
+// returns the distinct problems found, each starting with file and line.
+func lint() (problems []string, err error) {
+	seen := map[string]bool{}
+
+	for _, osName := range viper.GetStringSlice(pathLintOs) {
+		for _, archName := range viper.GetStringSlice(pathLintArch) {
+			for _, tags := range lintTagSets() {
+				var generator generate.Generator
+				generator, err = configuredGenerator(
+					secret.New(secret.Placeholder()),
+				)
+				if err != nil {
+					return nil, err
+				}
+
+				err = generator.
+					Os(osName).
+					Arch(archName).
+					Tags(tags).
+					Strict(true).
+					DryRun(true).
+					Prompter(generate.PlaceholderPrompter).
+					Generate()
+
+				templatesErr := &generate.TemplatesError{}
+				if err != nil && !errors.As(err, &templatesErr) {
+					return nil, err
+				} else if err == nil {
+					continue
+				}
+
+				for _, templateErr := range templatesErr.Errors {
+					msg := templateErr.Error()
+					if seen[msg] {
+						continue
+					}
+					seen[msg] = true
+
+					problems = append(
+						problems,
+						fmt.Sprintf(
+							"%s (os=%s arch=%s tags=%s)",
+							msg,
+							osName,
+							archName,
+							strings.Join(tags, ","),
+						),
+					)
+				}
+			}
+		}
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/viper"
+	"github.com/yo3jones/yconfig/generate"
+	"golang.org/x/term"
+)
+
+var (
+	promptStyle = lipgloss.NewStyle().
+			MarginTop(1).
+			PaddingLeft(3)
+
+	questionStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("12"))
+
+	selectedStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("10"))
+)
+
+var errPromptCancelled = errors.New("prompt cancelled")
+
+// promptMsg asks the view to show a prompt, the answer is sent back on the
+// answer channel, which is closed when the prompt is cancelled.
+type promptMsg struct {
+	prompt *generate.Prompt
+	answer chan string
+}
+
+// promptModel is the prompt currently shown under the progress rows.
+type promptModel struct {
+	*promptMsg
+	input  textinput.Model
+	choice int
+}
+
+// answersName is the machine local file the answers to template prompts are
+// kept in, outside of the dotfiles repo.
+func answersName() string {
+	if name := viper.GetString(pathAnswers); name != "" {
+		return configPath(name)
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(configDir, "yconfig", "answers.yaml")
+}
+
+// programPrompter asks prompts through the running program, or returns nil
+// when stdin isn't a terminal so missing answers fail instead of waiting.
+func programPrompter(program *tea.Program) generate.Prompter {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil
+	}
+
+	return func(prompt *generate.Prompt) (string, error) {
+		msg := &promptMsg{prompt: prompt, answer: make(chan string)}
+		program.Send(msg)
+
+		answer, ok := <-msg.answer
+		if !ok {
+			return "", errPromptCancelled
+		}
+
+		return answer, nil
+	}
+}
+
+func newPromptModel(msg *promptMsg) *promptModel {
+	m := &promptModel{promptMsg: msg}
+
+	switch msg.prompt.Kind {
+	case generate.PromptString:
+		m.input = textinput.New()
+		m.input.Placeholder = msg.prompt.Default
+		m.input.Focus()
+	case generate.PromptChoice:
+		for i, choice := range msg.prompt.Choices {
+			if choice == msg.prompt.Default {
+				m.choice = i
+			}
+		}
+	}
+
+	return m
+}
+
+// update handles a key press, returning whether the prompt was answered.
+func (m *promptModel) update(msg tea.KeyMsg) (answered bool, cmd tea.Cmd) {
+	prompt := m.prompt
+
+	switch prompt.Kind {
+	case generate.PromptString:
+		if msg.Type != tea.KeyEnter {
+			m.input, cmd = m.input.Update(msg)
+			return false, cmd
+		}
+		answer := m.input.Value()
+		if answer == "" {
+			answer = prompt.Default
+		}
+		m.answer <- answer
+	case generate.PromptBool:
+		switch {
+		case msg.String() == "y":
+			m.answer <- "true"
+		case msg.String() == "n":
+			m.answer <- "false"
+		case msg.Type == tea.KeyEnter && prompt.Default != "":
+			m.answer <- prompt.Default
+		default:
+			return false, nil
+		}
+	case generate.PromptChoice:
+		switch msg.String() {
+		case "up", "k":
+			if m.choice > 0 {
+				m.choice--
+			}
+			return false, nil
+		case "down", "j":
+			if m.choice < len(prompt.Choices)-1 {
+				m.choice++
+			}
+			return false, nil
+		case "enter":
+			m.answer <- prompt.Choices[m.choice]
+		default:
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (m *promptModel) cancel() {
+	close(m.answer)
+}
+
+func (m *promptModel) view() string {
+	prompt := m.prompt
+	sb := strings.Builder{}
+
+	sb.WriteString(questionStyle.Render("? " + prompt.Question))
+
+	switch prompt.Kind {
+	case generate.PromptString:
+		sb.WriteString("\n")
+		sb.WriteString(m.input.View())
+	case generate.PromptBool:
+		options := "y/n"
+		if prompt.Default == "true" {
+			options = "Y/n"
+		} else if prompt.Default == "false" {
+			options = "y/N"
+		}
+		sb.WriteString(fmt.Sprintf(" (%s)", options))
+	case generate.PromptChoice:
+		for i, choice := range prompt.Choices {
+			if i == m.choice {
+				sb.WriteString("\n" + selectedStyle.Render("› "+choice))
+			} else {
+				sb.WriteString("\n  " + choice)
+			}
+		}
+	}
+
+	return promptStyle.Render(sb.String())
+}
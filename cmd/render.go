@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	renderOs   string
+	renderArch string
+	renderTags []string
+)
+
+var renderCmd = &cobra.Command{
+	Use:   "render <template>",
+	Short: "print a rendered config file template",
+	Long: "render a single template to stdout, optionally as if running on " +
+		"another os, arch or with other tags",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		secrets, err := configuredSecrets()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		generator, err := configuredGenerator(secrets)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		if cmd.Flags().Changed("os") {
+			generator.Os(renderOs)
+		}
+
+		if cmd.Flags().Changed("arch") {
+			generator.Arch(renderArch)
+		}
+
+		if cmd.Flags().Changed("tag") {
+			generator.Tags(renderTags)
+		}
+
+		err = generator.Render(findTemplate(args[0]), os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	renderCmd.Flags().
+		StringVar(&renderOs, "os", "", "render as if running on this os")
+	renderCmd.Flags().
+		StringVar(&renderArch, "arch", "", "render as if running on this arch")
+	renderCmd.Flags().
+		StringSliceVar(&renderTags, "tag", []string{}, "tags to render with")
+
+	rootCmd.AddCommand(renderCmd)
+}
+
+// findTemplate resolves a template given either relative to the working
+// directory or to the top most template root containing it. Names found in
+// neither are passed on as logical paths.
+func findTemplate(name string) string {
+	if _, err := os.Stat(name); err == nil {
+		return name
+	}
+
+	roots := templateRoots()
+	for i := len(roots) - 1; i >= 0; i-- {
+		rootName := filepath.Join(roots[i], name)
+		if _, err := os.Stat(rootName); err == nil {
+			return rootName
+		}
+	}
+
+	return name
+}
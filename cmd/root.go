@@ -3,24 +3,82 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/yo3jones/yconfig/secret"
+	"github.com/yo3jones/yconfig/source"
+)
+
+var (
+	from      string
+	configDir string
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "yconfig",
 	Short: "yo3 config",
 	Long:  "yo3 config",
+	PersistentPreRunE: func(_ *cobra.Command, _ []string) error {
+		return readConfig()
+	},
 }
 
 func init() {
-	viper.AddConfigPath(".")
+	rootCmd.PersistentFlags().StringVar(
+		&from,
+		"from",
+		"",
+		"git repository url[@ref] to use the config and templates from",
+	)
+}
+
+// readConfig reads .yconfig from the working directory, or from the checkout
+// of the --from repository. The working directory is left as is so paths
+// given on the command line keep resolving against it.
+func readConfig() error {
+	if from != "" {
+		dir, commit, err := source.ParseGit(from).Fetch(os.Stderr)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "using %s at commit %s\n", from, commit)
+
+		configDir = dir
+	}
+
+	viper.AddConfigPath(configPath("."))
 	viper.SetConfigType("yaml")
 	viper.SetConfigName(".yconfig")
-	if err := viper.ReadInConfig(); err != nil {
-		panic(err)
+
+	return viper.ReadInConfig()
+}
+
+// configPath expands the home dir of a path from the config and resolves it
+// against the --from checkout when relative.
+func configPath(name string) string {
+	name = secret.ExpandHome(name)
+	if configDir == "" || name == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(configDir, name)
+}
+
+// configFileDir is the dir of the config file read, which setup runs in and
+// resolves the relative paths of its entries against.
+func configFileDir() string {
+	return filepath.Dir(viper.ConfigFileUsed())
+}
+
+// checkLocalConfig refuses to edit the config of a --from checkout, which is
+// replaced on the next fetch.
+func checkLocalConfig() error {
+	if from != "" {
+		return fmt.Errorf("the config of a --from repository can't be edited")
 	}
+	return nil
 }
 
 func Execute() {
@@ -0,0 +1,631 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/yo3jones/yconfig/generate"
+	"github.com/yo3jones/yconfig/secret"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	pathSecretProviders     string = "secrets.providers"
+	nameSecretStore         string = "store"
+	pathSecretStore         string = "secrets.store.path"
+	nameSecretKeyFile       string = "key-file"
+	pathSecretKeyFile       string = "secrets.store.keyFile"
+	pathSecretPassphraseEnv string = "secrets.store.passphraseEnv"
+
+	defaultSecretStore   = ".yconfig-secrets"
+	storeProviderName    = "store"
+	generatedKeyFileSize = 32
+)
+
+var (
+	secretNewKeyFile string
+	secretOutput     string
+	secretsTerminal  secret.Terminal
+)
+
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "manage the encrypted secrets store",
+	Long: "manage the passphrase or key file encrypted secrets store kept " +
+		"in the dotfiles repo, served to templates and setup scripts as the " +
+		"store provider",
+}
+
+var secretInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "create an empty secrets store",
+	Long: "create an empty secrets store, generating the configured key " +
+		"file when it doesn't exist yet",
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		exitOnError(secretInit())
+	},
+}
+
+var secretSetCmd = &cobra.Command{
+	Use:   "set <key> [value]",
+	Short: "set a secret",
+	Long: "set a secret in the store, reading the value from stdin when " +
+		"it isn't given",
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(_ *cobra.Command, args []string) {
+		exitOnError(secretSet(args))
+	},
+}
+
+var secretGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "print a secret",
+	Args:  cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		store, err := openSecretStore()
+		exitOnError(err)
+
+		value, exists := store.Get(args[0])
+		if !exists {
+			exitOnError(fmt.Errorf("secret %s not found", args[0]))
+		}
+
+		fmt.Println(value)
+	},
+}
+
+var secretListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list the secret keys",
+	Args:  cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		store, err := openSecretStore()
+		exitOnError(err)
+
+		for _, key := range store.Keys() {
+			fmt.Println(key)
+		}
+	},
+}
+
+var secretRmCmd = &cobra.Command{
+	Use:   "rm <key>",
+	Short: "remove a secret",
+	Args:  cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		store, err := openSecretStore()
+		exitOnError(err)
+
+		if !store.Delete(args[0]) {
+			exitOnError(fmt.Errorf("secret %s not found", args[0]))
+		}
+
+		exitOnError(store.Save())
+	},
+}
+
+var secretRekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "change the passphrase or key file",
+	Long: "re-encrypt the secrets store and every encrypted template with " +
+		"a new passphrase or key file",
+	Args: cobra.NoArgs,
+	Run: func(_ *cobra.Command, _ []string) {
+		exitOnError(secretRekey())
+	},
+}
+
+var secretEncryptCmd = &cobra.Command{
+	Use:   "encrypt <file>",
+	Short: "encrypt a whole file template",
+	Long: "encrypt a file with the store passphrase or key file so it can " +
+		"be kept in the template root, by default next to the file with the " +
+		generate.EncryptedSuffix + " suffix. generate decrypts it and writes " +
+		"it with mode 0600",
+	Args: cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		exitOnError(secretEncrypt(args[0]))
+	},
+}
+
+func init() {
+	var err error
+
+	secretCmd.PersistentFlags().
+		String(nameSecretStore, defaultSecretStore, "path of the secrets store")
+	err = viper.BindPFlag(
+		pathSecretStore,
+		secretCmd.PersistentFlags().Lookup(nameSecretStore),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	secretCmd.PersistentFlags().
+		String(nameSecretKeyFile, "", "key file to use instead of a passphrase")
+	err = viper.BindPFlag(
+		pathSecretKeyFile,
+		secretCmd.PersistentFlags().Lookup(nameSecretKeyFile),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	secretRekeyCmd.Flags().StringVar(
+		&secretNewKeyFile,
+		"new-key-file",
+		"",
+		"key file to switch to, generated when it doesn't exist",
+	)
+
+	secretEncryptCmd.Flags().StringVarP(
+		&secretOutput,
+		"output",
+		"o",
+		"",
+		"where to write the encrypted file",
+	)
+
+	secretCmd.AddCommand(
+		secretInitCmd,
+		secretSetCmd,
+		secretGetCmd,
+		secretListCmd,
+		secretRmCmd,
+		secretRekeyCmd,
+		secretEncryptCmd,
+	)
+
+	rootCmd.AddCommand(secretCmd)
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// configuredSecrets builds the secret providers from the config. Each command
+// builds them once and hands them to every generator it runs, so values are
+// only looked up once per run. The built in store is appended as the store
+// provider when it exists and no provider of that name is configured.
+func configuredSecrets() (*secret.Secrets, error) {
+	providersConfig := viper.Get(pathSecretProviders)
+
+	providers, err := secret.UnmarshalProviders(&providersConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, provider := range providers {
+		if provider.Name() == storeProviderName {
+			return secret.New(providers...).Terminal(secretsTerminal), nil
+		}
+	}
+
+	if storeName := secretStoreName(); fileExists(storeName) {
+		providers = append(
+			providers,
+			secret.NewStoreProvider(
+				storeProviderName,
+				storeName,
+				storePassphraseFunc(),
+			),
+		)
+	}
+
+	return secret.New(providers...).Terminal(secretsTerminal), nil
+}
+
+// programTerminal runs secret commands with the terminal handed over by the
+// running program, so a command can ask for a passphrase. It is nil when
+// stdin isn't a terminal and commands read stdin directly.
+func programTerminal(program *tea.Program) secret.Terminal {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil
+	}
+
+	return func(command *exec.Cmd) error {
+		exited := make(chan error)
+		program.Send(tea.ExecProcess(command, func(err error) tea.Msg {
+			exited <- err
+			return nil
+		})())
+		return <-exited
+	}
+}
+
+// configuredDecrypt decrypts encrypted templates with the store passphrase or
+// key file, read on first use.
+func configuredDecrypt() func(content []byte) ([]byte, error) {
+	passphraseFunc := storePassphraseFunc()
+
+	var (
+		passphrase []byte
+		mutex      sync.Mutex
+	)
+
+	return func(content []byte) ([]byte, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if passphrase == nil {
+			var err error
+			if passphrase, err = passphraseFunc(); err != nil {
+				return nil, err
+			}
+		}
+
+		return secret.Open(content, passphrase)
+	}
+}
+
+func secretStoreName() string {
+	name := viper.GetString(pathSecretStore)
+	if name == "" {
+		name = defaultSecretStore
+	}
+	return configPath(name)
+}
+
+func storePassphraseFunc() func() ([]byte, error) {
+	passphraseEnv := viper.GetString(pathSecretPassphraseEnv)
+	if passphraseEnv == "" {
+		passphraseEnv = secret.DefaultPassphraseEnv
+	}
+
+	return secret.PassphraseFunc(
+		configPath(viper.GetString(pathSecretKeyFile)),
+		passphraseEnv,
+	)
+}
+
+// storePassphrase reads the passphrase from the key file or environment,
+// falling back to asking on the terminal.
+func storePassphrase(confirm bool) ([]byte, error) {
+	passphrase, err := storePassphraseFunc()()
+	if err == nil {
+		return passphrase, nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, err
+	}
+
+	return promptPassphrase("passphrase", confirm)
+}
+
+func promptPassphrase(prompt string, confirm bool) ([]byte, error) {
+	passphrase, err := readHidden(prompt + ": ")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+
+	if !confirm {
+		return passphrase, nil
+	}
+
+	confirmation, err := readHidden("confirm " + prompt + ": ")
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(passphrase, confirmation) {
+		return nil, errors.New("passphrases don't match")
+	}
+
+	return passphrase, nil
+}
+
+func readHidden(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	return term.ReadPassword(int(os.Stdin.Fd()))
+}
+
+func openSecretStore() (*secret.Store, error) {
+	passphrase, err := storePassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return secret.OpenStore(secretStoreName(), passphrase)
+}
+
+// ensureKeyFile writes a random key to the key file unless it already exists.
+func ensureKeyFile(keyFile string) error {
+	keyFile = secret.ExpandHome(keyFile)
+	if keyFile == "" || fileExists(keyFile) {
+		return nil
+	}
+
+	key := make([]byte, generatedKeyFileSize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0o700); err != nil {
+		return err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(key) + "\n"
+	if err := os.WriteFile(keyFile, []byte(encoded), 0o600); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "generated key file %s\n", keyFile)
+
+	return nil
+}
+
+func secretInit() error {
+	storeName := secretStoreName()
+	if fileExists(storeName) {
+		return fmt.Errorf("secrets store %s already exists", storeName)
+	}
+
+	keyFile := configPath(viper.GetString(pathSecretKeyFile))
+	if err := ensureKeyFile(keyFile); err != nil {
+		return err
+	}
+
+	passphrase, err := storePassphrase(true)
+	if err != nil {
+		return err
+	}
+
+	if err = secret.NewStore(storeName, passphrase).Save(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "created secrets store %s\n", storeName)
+
+	return nil
+}
+
+func secretSet(args []string) error {
+	store, err := openSecretStore()
+	if err != nil {
+		return err
+	}
+
+	var value string
+	if len(args) > 1 {
+		value = args[1]
+	} else if value, err = readSecretValue(args[0]); err != nil {
+		return err
+	}
+
+	store.Set(args[0], value)
+
+	return store.Save()
+}
+
+// readSecretValue asks for the value on the terminal or reads all of stdin,
+// keeping values out of the shell history.
+func readSecretValue(key string) (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		value, err := readHidden(key + ": ")
+		return string(value), err
+	}
+
+	value, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(value), "\n"), nil
+}
+
+func secretRekey() error {
+	oldPassphrase, err := storePassphrase(false)
+	if err != nil {
+		return err
+	}
+
+	store, err := secret.OpenStore(secretStoreName(), oldPassphrase)
+	if err != nil {
+		return err
+	}
+
+	var passphrase []byte
+	if secretNewKeyFile != "" {
+		newKeyFile := configPath(secretNewKeyFile)
+		if err = ensureKeyFile(newKeyFile); err != nil {
+			return err
+		}
+		passphrase, err = secret.PassphraseFunc(newKeyFile, "")()
+	} else if term.IsTerminal(int(os.Stdin.Fd())) {
+		passphrase, err = promptPassphrase("new passphrase", true)
+	} else {
+		err = errors.New("rekey needs a terminal or --new-key-file")
+	}
+	if err != nil {
+		return err
+	}
+
+	encryptedNames, err := encryptedTemplates()
+	if err != nil {
+		return err
+	}
+
+	// everything is decrypted and sealed again before anything is written,
+	// so a wrong passphrase or unreadable template leaves the repo as is
+	rekeyed := make([][]byte, len(encryptedNames))
+	for i, name := range encryptedNames {
+		rekeyed[i], err = reencrypt(name, oldPassphrase, passphrase)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	store.Rekey(passphrase)
+	if err = store.Save(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "rekeyed %s\n", secretStoreName())
+
+	for i, name := range encryptedNames {
+		if err = os.WriteFile(name, rekeyed[i], 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "rekeyed %s\n", name)
+	}
+
+	return updateConfigKeyFile(secretNewKeyFile)
+}
+
+// updateConfigKeyFile points the key file of the config at the one the store
+// was rekeyed with, removing it when rekeyed with a passphrase, so the next
+// run doesn't read the old key.
+func updateConfigKeyFile(keyFile string) error {
+	changed := false
+	err := editConfig(func(root *yaml.Node) bool {
+		if keyFile == "" {
+			secrets := lookupMappingValue(root, "secrets")
+			store := lookupMappingValue(secrets, "store")
+			changed = removeMappingKey(store, "keyFile")
+			if changed && len(store.Content) == 0 {
+				removeMappingKey(secrets, "store")
+			}
+			return changed
+		}
+
+		store := mappingValue(
+			mappingValue(root, "secrets", yaml.MappingNode),
+			"store",
+			yaml.MappingNode,
+		)
+		*mappingValue(store, "keyFile", yaml.ScalarNode) = yaml.Node{
+			Kind:  yaml.ScalarNode,
+			Value: keyFile,
+		}
+		changed = true
+		return changed
+	})
+
+	switch {
+	case err == nil && changed:
+		fmt.Fprintf(
+			os.Stderr,
+			"updated %s in %s\n",
+			pathSecretKeyFile,
+			viper.ConfigFileUsed(),
+		)
+		return nil
+	case err == nil:
+		return nil
+	case keyFile == "":
+		return fmt.Errorf(
+			"remove %s from the config, updating it failed: %w",
+			pathSecretKeyFile,
+			err,
+		)
+	default:
+		return fmt.Errorf(
+			"set %s to %s in the config, updating it failed: %w",
+			pathSecretKeyFile,
+			keyFile,
+			err,
+		)
+	}
+}
+
+// encryptedTemplates finds the encrypted templates in every template root.
+func encryptedTemplates() (names []string, err error) {
+	for _, root := range templateRoots() {
+		err = filepath.WalkDir(
+			root,
+			func(name string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if entry.IsDir() && entry.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				if !entry.IsDir() &&
+					strings.HasSuffix(name, generate.EncryptedSuffix) {
+					names = append(names, name)
+				}
+				return nil
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return names, nil
+}
+
+// reencrypt returns the encrypted template sealed with the new passphrase.
+func reencrypt(name string, oldPassphrase, passphrase []byte) ([]byte, error) {
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := secret.Open(content, oldPassphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return secret.Seal(plain, passphrase)
+}
+
+func secretEncrypt(name string) error {
+	outputName := secretOutput
+	if outputName == "" {
+		outputName = name + generate.EncryptedSuffix
+	}
+
+	plain, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := storePassphrase(false)
+	if err != nil {
+		return err
+	}
+
+	content, err := secret.Seal(plain, passphrase)
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(outputName, content, 0o644); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "encrypted %s to %s\n", name, outputName)
+
+	return nil
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
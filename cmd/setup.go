@@ -1,11 +1,13 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/yo3jones/yconfig/generate"
 	"github.com/yo3jones/yconfig/setup"
 )
 
@@ -13,6 +15,11 @@ var (
 	tags           []string
 	hideCompledOut bool
 	delay          int
+	dryRun         bool
+	setupOs        string
+	setupArch      string
+	batchPackages  bool
+	setupMode      string
 )
 
 var setupCmd = &cobra.Command{
@@ -37,6 +44,36 @@ func init() {
 		)
 	setupCmd.Flags().
 		IntVar(&delay, "delay", 0, "add delay between setup entries")
+	setupCmd.Flags().
+		BoolVar(
+			&dryRun,
+			"dry-run",
+			false,
+			"print the setup commands without running them",
+		)
+	setupCmd.Flags().
+		StringVar(&setupOs, "os", "", "filter entries as if running on this os")
+	setupCmd.Flags().
+		StringVar(
+			&setupArch,
+			"arch",
+			"",
+			"filter entries as if running on this arch",
+		)
+	setupCmd.Flags().
+		StringVar(
+			&setupMode,
+			"mode",
+			setup.ModeInstall.String(),
+			"install, upgrade or remove the package entries",
+		)
+	setupCmd.Flags().
+		BoolVar(
+			&batchPackages,
+			"batch-packages",
+			false,
+			"install consecutive package entries in one invocation",
+		)
 
 	rootCmd.AddCommand(setupCmd)
 }
@@ -44,7 +81,20 @@ func init() {
 func run(entryNames []string) {
 	var setupErr error
 
+	mode, err := setup.ModeFromString(setupMode)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	program := tea.NewProgram(setup.InitModel())
+	secretsTerminal = programTerminal(program)
+
+	secrets, err := configuredSecrets()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	go func() {
 		var err error
@@ -58,8 +108,18 @@ func run(entryNames []string) {
 			PackageManagersConfig(&packageManagersConfig).
 			Config(&config).
 			Tags(tags).
+			Os(setupOs).
+			Arch(setupArch).
+			Mode(mode).
+			Dir(configFileDir()).
+			DryRun(dryRun).
+			Secrets(secrets).
+			Generator(func() (generate.Generator, error) {
+				return configuredGenerator(secrets)
+			}).
 			EntryNames(entryNames).
-			HideCompletedOut(hideCompledOut).
+			BatchPackages(batchPackages).
+			HideCompletedOut(hideCompledOut && !dryRun).
 			Delay(delay).
 			OnProgress(func(state *setup.SetupState) {
 				program.Send(state)
@@ -78,6 +138,7 @@ func run(entryNames []string) {
 	}
 
 	if setupErr != nil {
+		fmt.Fprintln(os.Stderr, setupErr)
 		os.Exit(1)
 	}
 }
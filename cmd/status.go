@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/yo3jones/yconfig/generate"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show the generated config files and their template layers",
+	Long: "list every selected template with the output it generates, the " +
+		"template root layer it comes from and whether it is linked",
+	Run: func(_ *cobra.Command, _ []string) {
+		secrets, err := configuredSecrets()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		generator, err := configuredGenerator(secrets)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		statuses, err := generator.Status()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "OUTPUT\tLAYER\tKIND\tLINKED\tTEMPLATE")
+		for _, status := range statuses {
+			fmt.Fprintf(
+				writer,
+				"%s\t%s\t%s\t%s\t%s\n",
+				status.Output,
+				status.Root,
+				status.Kind,
+				renderLinked(status),
+				status.Path,
+			)
+		}
+		writer.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
+
+func renderLinked(status *generate.TemplateStatus) string {
+	switch {
+	case status.Kind == generate.KindMerge,
+		status.Kind == generate.KindBlock:
+		return "-"
+	case status.Linked:
+		return "yes"
+	default:
+		return "no"
+	}
+}
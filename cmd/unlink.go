@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/yo3jones/yconfig/generate"
+)
+
+var unlinkCmd = &cobra.Command{
+	Use:   "unlink",
+	Short: "remove the links and managed blocks set up by generate",
+	Long:  "remove the links and managed blocks set up by generate",
+	Run: func(_ *cobra.Command, _ []string) {
+		runGenerator(generate.Generator.Unlink, "unlinked")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(unlinkCmd)
+}
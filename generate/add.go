@@ -0,0 +1,181 @@
+package generate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const linkTempSuffix = ".yconfig-tmp"
+
+// Add adopts an existing file from the users home dir into the top most
+// template root at the mirrored relative path, generates it and replaces the
+// original with a link to the generated file. When asTemplate is true the
+// template suffix is appended and the file is always rendered, so any
+// existing delimiters are escaped to render verbatim. Include is called with
+// the template before the original is replaced, when it fails the template is
+// removed and the original left as it was. The template path is returned.
+func (g *generator) Add(
+	name string,
+	asTemplate bool,
+	include func(templateName string) error,
+) (string, error) {
+	g.prepare()
+
+	relativeName, err := homeRelativePath(name)
+	if err != nil {
+		return "", err
+	}
+
+	root := g.topRoot()
+
+	templateName := filepath.Join(root, relativeName)
+	if asTemplate {
+		templateName += g.templateSuffix
+	}
+
+	if fileExists(templateName) {
+		return "", fmt.Errorf("template %s already exists", templateName)
+	}
+
+	binary, err := isBinary(name)
+	if err != nil {
+		return "", err
+	}
+
+	rendered := !binary && (asTemplate || g.templateSuffix == "")
+	if rendered {
+		delims := findDelims(g.delims, relativeName)
+		err = copyEscaped(name, templateName, delims)
+	} else {
+		err = copyFile(name, templateName)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	template := &templateFile{
+		root:        root,
+		path:        templateName,
+		logicalPath: templateName,
+	}
+	if err = g.classifyTemplate(template); err != nil {
+		os.Remove(templateName)
+		return "", err
+	}
+
+	destinationName := filepath.Join(
+		g.destinationRoot,
+		template.relativePath(),
+	)
+
+	err = generateTemplate(
+		template,
+		destinationName,
+		g.templateContext(),
+		g.renderOptions(),
+	)
+	if err != nil {
+		os.Remove(templateName)
+		return "", &TemplateError{Path: template.path, Err: err}
+	}
+
+	if err = include(templateName); err != nil {
+		os.Remove(templateName)
+		return "", err
+	}
+
+	if err = replaceWithLink(name, destinationName); err != nil {
+		return "", err
+	}
+
+	return templateName, nil
+}
+
+func homeRelativePath(name string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+
+	relativeName, err := filepath.Rel(home, absName)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(relativeName, "..") {
+		return "", fmt.Errorf("%s is not in the home dir %s", name, home)
+	}
+
+	info, err := os.Lstat(absName)
+	if err != nil {
+		return "", err
+	} else if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", name)
+	}
+
+	return relativeName, nil
+}
+
+// copyEscaped copies a file into a template so that it renders to its
+// original content, escaping the template delimiters.
+func copyEscaped(sourceName, templateName string, delims *Delims) error {
+	left, right := "{{", "}}"
+	if delims != nil {
+		left, right = delims.Left, delims.Right
+	}
+
+	content, err := os.ReadFile(sourceName)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(sourceName)
+	if err != nil {
+		return err
+	}
+
+	escaper := strings.NewReplacer(
+		left, fmt.Sprintf("%s%q%s", left, left, right),
+		right, fmt.Sprintf("%s%q%s", left, right, right),
+	)
+
+	if err = makeDirAll(templateName); err != nil {
+		return err
+	}
+
+	return os.WriteFile(
+		templateName,
+		[]byte(escaper.Replace(string(content))),
+		info.Mode().Perm(),
+	)
+}
+
+// replaceWithLink swaps name for a link to destinationName in a single
+// rename so the original is never missing.
+func replaceWithLink(name, destinationName string) error {
+	absName, err := filepath.Abs(destinationName)
+	if err != nil {
+		return err
+	}
+
+	tempName := name + linkTempSuffix
+	os.Remove(tempName)
+
+	if err = os.Symlink(absName, tempName); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tempName, name); err != nil {
+		os.Remove(tempName)
+		return err
+	}
+
+	return nil
+}
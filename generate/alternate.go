@@ -0,0 +1,196 @@
+package generate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yo3jones/yconfig/archtypes"
+	"github.com/yo3jones/yconfig/ostypes"
+)
+
+const (
+	alternateSeparator     = "##"
+	alternateCondSeparator = ","
+	alternateKeySeparator  = "."
+
+	scoreOs   = 1
+	scoreArch = 2
+	scoreTag  = 4
+	scoreHost = 8
+)
+
+// templateFile is a template found in the template root along with the
+// logical path it renders to once any alternate suffix has been removed.
+type templateFile struct {
+	root        string
+	path        string
+	logicalPath string
+	raw         bool
+	encrypted   bool
+	delims      *Delims
+	merge       *Merge
+	block       *Block
+	onChange    []*OnChange
+}
+
+type alternateMatcher struct {
+	os   ostypes.Os
+	arch archtypes.Arch
+	host string
+	tags map[string]bool
+}
+
+func newAlternateMatcher(
+	osName, archName string,
+	tags map[string]bool,
+) (matcher *alternateMatcher, err error) {
+	matcher = &alternateMatcher{tags: tags}
+
+	if matcher.os, err = ostypes.OsFromString(osName); err != nil {
+		return nil, err
+	}
+
+	if matcher.arch, err = archtypes.ArchFromString(archName); err != nil {
+		return nil, err
+	}
+
+	if matcher.host, err = os.Hostname(); err != nil {
+		return nil, err
+	}
+
+	return matcher, nil
+}
+
+// splitAlternate splits a template path like `.gitconfig##os.darwin` into its
+// logical path and the conditions following the separator.
+func splitAlternate(
+	name string,
+) (logicalPath, conditions string, isAlternate bool) {
+	dir, file := filepath.Split(name)
+
+	i := strings.Index(file, alternateSeparator)
+	if i < 0 {
+		return name, "", false
+	}
+
+	return dir + file[:i], file[i+len(alternateSeparator):], true
+}
+
+func (m *alternateMatcher) score(
+	conditions string,
+) (score int, match bool, err error) {
+	for _, cond := range strings.Split(conditions, alternateCondSeparator) {
+		var (
+			condScore int
+			condMatch bool
+		)
+
+		if condScore, condMatch, err = m.scoreCondition(cond); err != nil {
+			return 0, false, err
+		} else if !condMatch {
+			return 0, false, nil
+		}
+
+		score += condScore
+	}
+
+	return score, true, nil
+}
+
+func (m *alternateMatcher) scoreCondition(
+	cond string,
+) (score int, match bool, err error) {
+	cond = strings.TrimSpace(cond)
+	if strings.ToLower(cond) == "default" {
+		return 0, true, nil
+	}
+
+	key, value, found := strings.Cut(cond, alternateKeySeparator)
+	if !found || value == "" {
+		return 0, false, fmt.Errorf("invalid alternate condition %s", cond)
+	}
+
+	switch strings.ToLower(key) {
+	case "os", "o":
+		var os ostypes.Os
+		if os, err = ostypes.OsFromString(value); err != nil {
+			return 0, false, err
+		}
+		return scoreOs, os == m.os, nil
+	case "arch", "a":
+		var arch archtypes.Arch
+		if arch, err = archtypes.ArchFromString(value); err != nil {
+			return 0, false, err
+		}
+		return scoreArch, arch == m.arch, nil
+	case "tag", "t":
+		_, exists := m.tags[strings.ToLower(value)]
+		return scoreTag, exists, nil
+	case "host", "h":
+		return scoreHost, m.isHost(value), nil
+	}
+
+	return 0, false, fmt.Errorf("unknown alternate condition %s", key)
+}
+
+func (m *alternateMatcher) isHost(host string) bool {
+	if strings.EqualFold(host, m.host) {
+		return true
+	}
+
+	short, _, _ := strings.Cut(m.host, ".")
+
+	return strings.EqualFold(host, short)
+}
+
+// selectAlternates groups the found template files by logical path and keeps
+// the most specific matching alternate of each group. Plain files act as the
+// default alternate and groups without any match are dropped.
+func selectAlternates(
+	files []string,
+	matcher *alternateMatcher,
+) (templates []*templateFile, err error) {
+	sort.Strings(files)
+
+	bestScores := map[string]int{}
+	best := map[string]*templateFile{}
+	logicalPaths := []string{}
+
+	for _, file := range files {
+		logicalPath, conditions, isAlternate := splitAlternate(file)
+
+		score := 0
+		if isAlternate {
+			var match bool
+			if score, match, err = matcher.score(conditions); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			} else if !match {
+				continue
+			}
+		}
+
+		bestScore, exists := bestScores[logicalPath]
+		if exists && bestScore >= score {
+			continue
+		}
+
+		if !exists {
+			logicalPaths = append(logicalPaths, logicalPath)
+		}
+
+		bestScores[logicalPath] = score
+		best[logicalPath] = &templateFile{path: file, logicalPath: logicalPath}
+	}
+
+	sort.Strings(logicalPaths)
+
+	templates = make([]*templateFile, len(logicalPaths))
+	for i, logicalPath := range logicalPaths {
+		templates[i] = best[logicalPath]
+	}
+
+	return templates, nil
+}
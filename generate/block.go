@@ -0,0 +1,227 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultBlockComment = "#"
+	blockBegin          = "BEGIN yconfig"
+	blockEnd            = "END yconfig"
+)
+
+// Block renders the templates matching Glob into a marked block inside a
+// target file the generator doesn't own, leaving the rest of the file as is.
+// Target defaults to the file the template would otherwise be linked to and
+// may start with ~/ for the home dir. Name identifies the block and defaults
+// to the template path relative to the template root. Comment is the line
+// comment prefix used for the markers, # by default.
+type Block struct {
+	Glob    string
+	Target  string
+	Name    string
+	Comment string
+}
+
+func findBlock(blocks []*Block, relativeName string) *Block {
+	for _, b := range blocks {
+		if globMatches(b.Glob, relativeName) {
+			return b
+		}
+	}
+	return nil
+}
+
+func (b *Block) markers(relativeName string) (begin, end string) {
+	name := b.Name
+	if name == "" {
+		name = relativeName
+	}
+
+	comment := b.Comment
+	if comment == "" {
+		comment = defaultBlockComment
+	}
+
+	return fmt.Sprintf("%s %s %s", comment, blockBegin, name),
+		fmt.Sprintf("%s %s %s", comment, blockEnd, name)
+}
+
+func (b *Block) targetName(defaultName string) (string, error) {
+	if b.Target == "" {
+		return defaultName, nil
+	}
+
+	if !strings.HasPrefix(b.Target, "~/") {
+		return b.Target, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, b.Target[2:]), nil
+}
+
+// blockTemplate renders the template and inserts or replaces its block in
+// the target file.
+func (g *generator) blockTemplate(
+	template *templateFile,
+	relativeName, destinationName string,
+) error {
+	targetName, err := g.blockTargetName(
+		template,
+		relativeName,
+		destinationName,
+	)
+	if err != nil {
+		return err
+	}
+
+	rendered := &bytes.Buffer{}
+	err = renderTemplate(
+		template,
+		rendered,
+		g.templateContext(),
+		g.renderOptions(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if g.dryRun {
+		return nil
+	}
+
+	begin, end := template.block.markers(relativeName)
+
+	return updateBlock(targetName, func(lines []string) []string {
+		return replaceBlock(lines, begin, end, rendered.String())
+	})
+}
+
+// unblockTemplate removes the block of the template from the target file.
+func (g *generator) unblockTemplate(
+	template *templateFile,
+	relativeName, destinationName string,
+) error {
+	targetName, err := g.blockTargetName(
+		template,
+		relativeName,
+		destinationName,
+	)
+	if err != nil {
+		return err
+	}
+
+	if !fileExists(targetName) {
+		return nil
+	}
+
+	begin, end := template.block.markers(relativeName)
+
+	return updateBlock(targetName, func(lines []string) []string {
+		return removeBlock(lines, begin, end)
+	})
+}
+
+func (g *generator) blockTargetName(
+	template *templateFile,
+	relativeName, destinationName string,
+) (string, error) {
+	defaultName, err := g.targetName(relativeName, destinationName)
+	if err != nil {
+		return "", err
+	}
+
+	return template.block.targetName(defaultName)
+}
+
+func updateBlock(
+	targetName string,
+	update func(lines []string) []string,
+) error {
+	lines := []string{}
+	perm := os.FileMode(0o644)
+
+	if content, err := os.ReadFile(targetName); err == nil {
+		lines = splitLines(string(content))
+		if info, err := os.Stat(targetName); err == nil {
+			perm = info.Mode().Perm()
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	lines = update(lines)
+
+	content := strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		content += "\n"
+	}
+
+	if err := makeDirAll(targetName); err != nil {
+		return err
+	}
+
+	// written in place rather than renamed so ownership of files like
+	// /etc/hosts is kept
+	return os.WriteFile(targetName, []byte(content), perm)
+}
+
+func splitLines(content string) []string {
+	content = strings.TrimSuffix(content, "\n")
+	if content == "" {
+		return []string{}
+	}
+	return strings.Split(content, "\n")
+}
+
+func findBlockLines(lines []string, begin, end string) (start, stop int) {
+	start, stop = -1, -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if start < 0 && trimmed == begin {
+			start = i
+		} else if start >= 0 && trimmed == end {
+			return start, i
+		}
+	}
+	return -1, -1
+}
+
+func replaceBlock(lines []string, begin, end, content string) []string {
+	block := []string{begin}
+	block = append(block, splitLines(content)...)
+	block = append(block, end)
+
+	start, stop := findBlockLines(lines, begin, end)
+	if start < 0 {
+		return append(lines, block...)
+	}
+
+	replaced := make([]string, 0, len(lines)-(stop-start+1)+len(block))
+	replaced = append(replaced, lines[:start]...)
+	replaced = append(replaced, block...)
+	replaced = append(replaced, lines[stop+1:]...)
+
+	return replaced
+}
+
+func removeBlock(lines []string, begin, end string) []string {
+	start, stop := findBlockLines(lines, begin, end)
+	if start < 0 {
+		return lines
+	}
+
+	removed := make([]string, 0, len(lines)-(stop-start+1))
+	removed = append(removed, lines[:start]...)
+	removed = append(removed, lines[stop+1:]...)
+
+	return removed
+}
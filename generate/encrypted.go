@@ -0,0 +1,59 @@
+package generate
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// EncryptedSuffix marks a whole file template kept encrypted in the template
+// root, for example `.ssh/id_ed25519.yconfig-encrypted`. It is decrypted at
+// render time and written with encryptedPerm.
+const (
+	EncryptedSuffix = ".yconfig-encrypted"
+	encryptedPerm   = 0o600
+)
+
+func decrypt(sourceName string, options *renderOptions) ([]byte, error) {
+	if options.decrypt == nil {
+		return nil, errors.New("no key configured for encrypted templates")
+	}
+
+	content, err := os.ReadFile(sourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	return options.decrypt(content)
+}
+
+func decryptTo(
+	sourceName string,
+	writer io.Writer,
+	options *renderOptions,
+) error {
+	plain, err := decrypt(sourceName, options)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(plain)
+
+	return err
+}
+
+func decryptFile(
+	sourceName, destinationName string,
+	options *renderOptions,
+) error {
+	plain, err := decrypt(sourceName, options)
+	if err != nil {
+		return err
+	}
+
+	if err = prepareDestination(destinationName); err != nil {
+		return err
+	}
+
+	return os.WriteFile(destinationName, plain, encryptedPerm)
+}
@@ -1,32 +1,125 @@
 package generate
 
 import (
+	"fmt"
+	"io"
 	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/yo3jones/yconfig/secret"
 )
 
+const templateErrorPrefix = "template: "
+
 type Generator interface {
 	TemplateRoot(templateRoot string) Generator
+	TemplateRoots(templateRoots []string) Generator
 	DesinationRoot(destinationRoot string) Generator
 	Include(include []string) Generator
 	Exclude(exclude []string) Generator
 	Link(link bool) Generator
 	Tags(tags []string) Generator
+	Os(os string) Generator
+	Arch(arch string) Generator
+	Strict(strict bool) Generator
+	DryRun(dryRun bool) Generator
+	TemplateSuffix(templateSuffix string) Generator
+	Delims(delims []*Delims) Generator
+	Merges(merges []*Merge) Generator
+	Blocks(blocks []*Block) Generator
+	OnChange(hooks []*OnChange) Generator
+	HookRunner(hookRunner HookRunner) Generator
+	Secrets(secrets *secret.Secrets) Generator
+	Decrypt(decrypt func(content []byte) ([]byte, error)) Generator
+	Answers(answersName string) Generator
+	Prompter(prompter Prompter) Generator
+	Reprompt(reprompt bool) Generator
 	Delay(delay int) Generator
 	OnProgress(onProgress func(progress *Progress)) Generator
+	Parallel(parallel int) Generator
 	Generate() error
+	Unlink() error
+	Status() ([]*TemplateStatus, error)
+	Render(name string, writer io.Writer) error
+	Add(
+		name string,
+		asTemplate bool,
+		include func(templateName string) error,
+	) (templateName string, err error)
 }
 
 type TemplateProgress struct {
 	Path   string
+	Root   string
 	Status ProgressStatus
+	Out    []byte
+	Err    error
 }
 
 type Progress struct {
 	TemplatesProgress []*TemplateProgress
 }
 
+func (p *Progress) ErroredCount() int {
+	count := 0
+	for _, templateProgress := range p.TemplatesProgress {
+		if templateProgress.Status == Error {
+			count++
+		}
+	}
+	return count
+}
+
+func (p *Progress) CompletedCount() int {
+	count := 0
+	for _, templateProgress := range p.TemplatesProgress {
+		if templateProgress.Status == Complete {
+			count++
+		}
+	}
+	return count
+}
+
+// TemplateError is the error of a single template. Errors from text/template
+// already start with the template path and line so they are not prefixed
+// again.
+type TemplateError struct {
+	Path string
+	Err  error
+}
+
+func (e *TemplateError) Error() string {
+	msg := e.Err.Error()
+	if strings.HasPrefix(msg, templateErrorPrefix) {
+		return strings.TrimPrefix(msg, templateErrorPrefix)
+	}
+	return fmt.Sprintf("%s: %s", e.Path, msg)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// TemplatesError is returned from Generate when one or more templates failed.
+// The individual errors are available on each TemplateProgress.
+type TemplatesError struct {
+	Errors []error
+	Total  int
+}
+
+func (e *TemplatesError) Error() string {
+	return fmt.Sprintf(
+		"%d of %d templates failed to generate",
+		len(e.Errors),
+		e.Total,
+	)
+}
+
 type ProgressStatus int
 
 const (
@@ -34,6 +127,8 @@ const (
 	Waiting
 	Generating
 	Linking
+	Unlinking
+	Hooking
 	Complete
 	Error
 )
@@ -46,6 +141,10 @@ func (ps ProgressStatus) String() string {
 		return "Generating"
 	case Linking:
 		return "Linking"
+	case Unlinking:
+		return "Unlinking"
+	case Hooking:
+		return "Hooking"
 	case Complete:
 		return "Complete"
 	case Error:
@@ -55,20 +154,46 @@ func (ps ProgressStatus) String() string {
 }
 
 type generator struct {
-	templateRoot    string
+	templateRoots   []string
 	destinationRoot string
 	include         []string
 	exclude         []string
 	link            bool
 	tags            map[string]bool
+	os              string
+	arch            string
+	strict          bool
+	dryRun          bool
+	templateSuffix  string
+	delims          []*Delims
+	merges          []*Merge
+	blocks          []*Block
+	onChange        []*OnChange
+	hookRunner      HookRunner
+	secrets         *secret.Secrets
+	decrypt         func(content []byte) ([]byte, error)
+	answers         *answers
+	prompter        Prompter
+	reprompt        bool
 	delay           int
 	onProgress      func(progress *Progress)
-	templates       []string
+	parallel        int
+	templates       []*templateFile
 	progress        *Progress
+	progressMutex   sync.Mutex
+	targetLocks     map[string]*sync.Mutex
+	targetMutex     sync.Mutex
 }
 
 func (g *generator) TemplateRoot(templateRoot string) Generator {
-	g.templateRoot = templateRoot
+	g.templateRoots = []string{templateRoot}
+	return g
+}
+
+// TemplateRoots sets an ordered list of template roots where templates in a
+// later root override those at the same relative path in earlier roots.
+func (g *generator) TemplateRoots(templateRoots []string) Generator {
+	g.templateRoots = templateRoots
 	return g
 }
 
@@ -101,6 +226,87 @@ func (g *generator) Tags(tags []string) Generator {
 	return g
 }
 
+func (g *generator) Os(os string) Generator {
+	g.os = os
+	return g
+}
+
+func (g *generator) Arch(arch string) Generator {
+	g.arch = arch
+	return g
+}
+
+func (g *generator) Strict(strict bool) Generator {
+	g.strict = strict
+	return g
+}
+
+func (g *generator) DryRun(dryRun bool) Generator {
+	g.dryRun = dryRun
+	return g
+}
+
+func (g *generator) TemplateSuffix(templateSuffix string) Generator {
+	g.templateSuffix = templateSuffix
+	return g
+}
+
+func (g *generator) Delims(delims []*Delims) Generator {
+	g.delims = delims
+	return g
+}
+
+func (g *generator) Merges(merges []*Merge) Generator {
+	g.merges = merges
+	return g
+}
+
+func (g *generator) Blocks(blocks []*Block) Generator {
+	g.blocks = blocks
+	return g
+}
+
+func (g *generator) OnChange(hooks []*OnChange) Generator {
+	g.onChange = hooks
+	return g
+}
+
+func (g *generator) HookRunner(hookRunner HookRunner) Generator {
+	g.hookRunner = hookRunner
+	return g
+}
+
+func (g *generator) Secrets(secrets *secret.Secrets) Generator {
+	g.secrets = secrets
+	return g
+}
+
+func (g *generator) Decrypt(
+	decrypt func(content []byte) ([]byte, error),
+) Generator {
+	g.decrypt = decrypt
+	return g
+}
+
+// Answers sets the machine local state file the answers to prompts are kept
+// in.
+func (g *generator) Answers(answersName string) Generator {
+	g.answers = newAnswers(answersName)
+	return g
+}
+
+func (g *generator) Prompter(prompter Prompter) Generator {
+	g.prompter = prompter
+	return g
+}
+
+// Reprompt asks every prompt again once per run, offering the kept answer as
+// the default.
+func (g *generator) Reprompt(reprompt bool) Generator {
+	g.reprompt = reprompt
+	return g
+}
+
 func (g *generator) Delay(delay int) Generator {
 	g.delay = delay
 	return g
@@ -111,14 +317,34 @@ func (g *generator) OnProgress(onProgress func(progress *Progress)) Generator {
 	return g
 }
 
+// Parallel sets how many templates are generated at once, one at a time when
+// not positive.
+func (g *generator) Parallel(parallel int) Generator {
+	g.parallel = parallel
+	return g
+}
+
 func (g *generator) prepare() {
 	if g.onProgress == nil {
 		g.onProgress = func(_ *Progress) {}
 	}
+	if g.os == "" {
+		g.os = runtime.GOOS
+	}
+	if g.arch == "" {
+		g.arch = runtime.GOARCH
+	}
 }
 
-func (g *generator) initTempalates() {
-	g.templates = glob(g.templateRoot, g.include, g.exclude)
+func (g *generator) initTempalates() (err error) {
+	var matcher *alternateMatcher
+
+	matcher, err = newAlternateMatcher(g.os, g.arch, g.tags)
+	if err != nil {
+		return err
+	}
+
+	return g.initLayers(matcher)
 }
 
 func (g *generator) initProgress() {
@@ -126,14 +352,53 @@ func (g *generator) initProgress() {
 	for _, template := range g.templates {
 		g.progress.TemplatesProgress = append(
 			g.progress.TemplatesProgress,
-			&TemplateProgress{template, Waiting},
+			&TemplateProgress{
+				Path:   template.path,
+				Root:   template.root,
+				Status: Waiting,
+			},
 		)
 	}
 }
 
+// updateProgress changes the progress of a template and reports a snapshot of
+// the whole progress. Updates from parallel workers are serialized so
+// onProgress is never called concurrently.
+func (g *generator) updateProgress(i int, update func(p *TemplateProgress)) {
+	g.progressMutex.Lock()
+	defer g.progressMutex.Unlock()
+
+	if i >= 0 {
+		update(g.progress.TemplatesProgress[i])
+	}
+	g.onProgress(g.progress.snapshot())
+}
+
 func (g *generator) notifyProgress(i int, newStatus ProgressStatus) {
-	g.progress.TemplatesProgress[i].Status = newStatus
-	g.onProgress(g.progress)
+	g.updateProgress(i, func(p *TemplateProgress) {
+		p.Status = newStatus
+	})
+}
+
+func (g *generator) notifyError(i int, err error) {
+	g.updateProgress(i, func(p *TemplateProgress) {
+		p.Err = err
+		p.Status = Error
+	})
+}
+
+// snapshot copies the progress so it can be read while templates are still
+// being generated.
+func (p *Progress) snapshot() *Progress {
+	snapshot := &Progress{
+		TemplatesProgress: make([]*TemplateProgress, len(p.TemplatesProgress)),
+	}
+	for i, templateProgress := range p.TemplatesProgress {
+		copied := *templateProgress
+		copied.Out = copied.Out[:len(copied.Out):len(copied.Out)]
+		snapshot.TemplatesProgress[i] = &copied
+	}
+	return snapshot
 }
 
 func (g *generator) sleep() {
@@ -144,22 +409,129 @@ func (g *generator) sleep() {
 }
 
 func (g *generator) generateTemplate(i int) error {
-	templateName := g.templates[i]
+	template := g.templates[i]
 
 	g.sleep()
 
 	g.notifyProgress(i, Generating)
 
-	relativeName := getRelativePath(g.templateRoot, templateName)
+	relativeName := template.relativePath()
 	destinationName := path.Join(g.destinationRoot, relativeName)
 
-	err := generateTemplate(templateName, destinationName, g.tags)
+	var before []byte
+
+	outputName, err := g.outputName(template, relativeName, destinationName)
+	if err == nil {
+		var unlock func()
+		unlock, err = g.lockTargets(template, relativeName, outputName)
+		if err == nil {
+			defer unlock()
+		}
+	}
+
+	hooked := len(template.onChange) > 0 && !g.dryRun
+	if err == nil && hooked {
+		before, err = fileDigest(outputName)
+	}
+
+	if err == nil {
+		switch {
+		case template.merge != nil:
+			err = g.mergeTemplate(template, relativeName, destinationName)
+		case template.block != nil:
+			err = g.blockTemplate(template, relativeName, destinationName)
+		default:
+			err = g.generateAndLink(
+				i,
+				template,
+				relativeName,
+				destinationName,
+			)
+		}
+	}
+
+	if err == nil && hooked {
+		err = g.runOnChange(i, template, outputName, before)
+	}
+
 	if err != nil {
-		g.notifyProgress(i, Error)
+		err = &TemplateError{Path: template.path, Err: err}
+		g.notifyError(i, err)
 		return err
 	}
 
-	if g.link {
+	g.sleep()
+
+	g.notifyProgress(i, Complete)
+
+	return nil
+}
+
+// lockTargets serializes the templates writing the same files, like block
+// and merge templates sharing a target, for as long as a template generates
+// and runs its hooks. It returns the func releasing the locks.
+func (g *generator) lockTargets(
+	template *templateFile,
+	relativeName, outputName string,
+) (unlock func(), err error) {
+	names := []string{outputName}
+	if template.merge == nil && template.block == nil && g.link {
+		var linkName string
+		if linkName, err = g.targetName(relativeName, outputName); err != nil {
+			return nil, err
+		}
+		names = append(names, linkName)
+	}
+
+	// locked in order so two templates never wait on each other
+	sort.Strings(names)
+
+	locks := make([]*sync.Mutex, 0, len(names))
+	g.targetMutex.Lock()
+	if g.targetLocks == nil {
+		g.targetLocks = map[string]*sync.Mutex{}
+	}
+	for i, name := range names {
+		if i > 0 && names[i-1] == name {
+			continue
+		}
+		if g.targetLocks[name] == nil {
+			g.targetLocks[name] = &sync.Mutex{}
+		}
+		locks = append(locks, g.targetLocks[name])
+	}
+	g.targetMutex.Unlock()
+
+	for _, lock := range locks {
+		lock.Lock()
+	}
+
+	return func() {
+		for _, lock := range locks {
+			lock.Unlock()
+		}
+	}, nil
+}
+
+func (g *generator) generateAndLink(
+	i int,
+	template *templateFile,
+	relativeName, destinationName string,
+) error {
+	options := g.renderOptions()
+	options.dryRun = g.dryRun
+
+	err := generateTemplate(
+		template,
+		destinationName,
+		g.templateContext(),
+		options,
+	)
+	if err != nil {
+		return err
+	}
+
+	if g.link && !g.dryRun {
 		g.sleep()
 		g.notifyProgress(i, Linking)
 		if err := makeLink(relativeName, destinationName); err != nil {
@@ -167,6 +539,33 @@ func (g *generator) generateTemplate(i int) error {
 		}
 	}
 
+	return nil
+}
+
+func (g *generator) unlinkTemplate(i int) error {
+	template := g.templates[i]
+
+	g.sleep()
+
+	g.notifyProgress(i, Unlinking)
+
+	relativeName := template.relativePath()
+	destinationName := path.Join(g.destinationRoot, relativeName)
+
+	var err error
+	switch {
+	case template.merge != nil:
+	case template.block != nil:
+		err = g.unblockTemplate(template, relativeName, destinationName)
+	default:
+		err = removeLink(relativeName, destinationName)
+	}
+	if err != nil {
+		err = &TemplateError{Path: template.path, Err: err}
+		g.notifyError(i, err)
+		return err
+	}
+
 	g.sleep()
 
 	g.notifyProgress(i, Complete)
@@ -174,16 +573,55 @@ func (g *generator) generateTemplate(i int) error {
 	return nil
 }
 
-func (g *generator) generateTemplates() error {
-	var err error
+func (g *generator) templateContext() *TemplateContext {
+	return &TemplateContext{
+		OS:   g.os,
+		Arch: g.arch,
+		Tags: g.tags,
+	}
+}
+
+func (g *generator) generateTemplates(
+	generateTemplate func(i int) error,
+) error {
+	parallel := g.parallel
+	if parallel <= 0 {
+		parallel = 1
+	}
+
+	// errors are kept per template so they are reported in template order
+	// whichever worker finishes first
+	templateErrs := make([]error, len(g.templates))
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < parallel && w < len(g.templates); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				templateErrs[i] = generateTemplate(i)
+			}
+		}()
+	}
 
 	for i := range g.templates {
-		err = g.generateTemplate(i)
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	errs := []error{}
+	for _, err := range templateErrs {
 		if err != nil {
-			return err
+			errs = append(errs, err)
 		}
 	}
 
+	if len(errs) > 0 {
+		return &TemplatesError{Errors: errs, Total: len(g.templates)}
+	}
+
 	return nil
 }
 
@@ -192,12 +630,14 @@ func (g *generator) Generate() error {
 
 	g.prepare()
 
-	g.initTempalates()
+	if err = g.initTempalates(); err != nil {
+		return err
+	}
 	g.initProgress()
 
-	g.onProgress(g.progress)
+	g.updateProgress(-1, nil)
 
-	err = g.generateTemplates()
+	err = g.generateTemplates(g.generateTemplate)
 	if err != nil {
 		return err
 	}
@@ -205,6 +645,73 @@ func (g *generator) Generate() error {
 	return nil
 }
 
+// Unlink undoes what Generate set up outside the destination root. Links
+// pointing to generated files are removed and managed blocks are taken out
+// of their target files. Merged files are left as they are.
+func (g *generator) Unlink() error {
+	var err error
+
+	g.prepare()
+
+	if err = g.initTempalates(); err != nil {
+		return err
+	}
+	g.initProgress()
+
+	g.updateProgress(-1, nil)
+
+	return g.generateTemplates(g.unlinkTemplate)
+}
+
 func New() Generator {
-	return &generator{link: true}
+	return &generator{link: true, answers: newAnswers("")}
+}
+
+// Render writes a single template to writer using the configured os, arch,
+// tags and template options without touching the destination root. A logical
+// path like `.gitconfig` renders the alternate Generate selects for it, any
+// other name is rendered as the template file it names.
+func (g *generator) Render(name string, writer io.Writer) (err error) {
+	g.prepare()
+
+	template, err := g.findTemplate(name)
+	if err != nil {
+		return err
+	}
+
+	err = renderTemplate(
+		template,
+		writer,
+		g.templateContext(),
+		g.renderOptions(),
+	)
+	if err != nil {
+		return &TemplateError{Path: template.path, Err: err}
+	}
+
+	return nil
+}
+
+// findTemplate resolves name against the selected templates by their output
+// path or logical path, falling back to the template file itself.
+func (g *generator) findTemplate(name string) (*templateFile, error) {
+	if err := g.initTempalates(); err != nil {
+		return nil, err
+	}
+
+	name = filepath.Clean(name)
+	for _, template := range g.templates {
+		if template.relativePath() == name || template.logicalPath == name {
+			return template, nil
+		}
+	}
+
+	template := &templateFile{root: g.rootOf(name), path: name}
+	template.logicalPath, _, _ = splitAlternate(name)
+
+	if err := g.classifyTemplate(template); err != nil {
+		return nil, err
+	}
+
+	return template, nil
 }
@@ -28,20 +28,25 @@ func findFiles(glob string) []string {
 	return files
 }
 
+// glob finds the files matching the include globs but none of the exclude
+// globs. Every glob also matches the alternates and delete markers of the
+// files it names, so a literal `.gitconfig` includes `.gitconfig##os.darwin`.
 func glob(root string, include, exclude []string) []string {
 	filesSet := map[string]bool{}
 
 	for _, inc := range include {
-		files := findFiles(filepath.Join(root, inc))
-		for _, file := range files {
-			filesSet[file] = true
+		for _, pattern := range globVariants(filepath.Join(root, inc)) {
+			for _, file := range findFiles(pattern) {
+				filesSet[file] = true
+			}
 		}
 	}
 
 	for _, excl := range exclude {
-		files := findFiles(filepath.Join(root, excl))
-		for _, file := range files {
-			delete(filesSet, file)
+		for _, pattern := range globVariants(filepath.Join(root, excl)) {
+			for _, file := range findFiles(pattern) {
+				delete(filesSet, file)
+			}
 		}
 	}
 
@@ -52,3 +57,11 @@ func glob(root string, include, exclude []string) []string {
 
 	return files
 }
+
+func globVariants(pattern string) []string {
+	return []string{
+		pattern,
+		pattern + alternateSeparator + "*",
+		pattern + deleteMarkerSuffix,
+	}
+}
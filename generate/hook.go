@@ -0,0 +1,110 @@
+package generate
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// OnChange runs Script after a template matching Glob generated different
+// content than the output had before, for example to reload tmux once
+// .tmux.conf changed. Every matching hook runs, in order.
+type OnChange struct {
+	Glob   string
+	Script string
+}
+
+// HookRunner runs a hook script, writing its output to writer.
+type HookRunner func(script string, writer io.Writer) error
+
+func findOnChange(hooks []*OnChange, relativeName string) []*OnChange {
+	var found []*OnChange
+	for _, hook := range hooks {
+		if globMatches(hook.Glob, relativeName) {
+			found = append(found, hook)
+		}
+	}
+	return found
+}
+
+// outputName is the file a template ends up writing, which for merges and
+// blocks is the target rather than the destination.
+func (g *generator) outputName(
+	template *templateFile,
+	relativeName, destinationName string,
+) (string, error) {
+	switch {
+	case template.merge != nil:
+		return g.targetName(relativeName, destinationName)
+	case template.block != nil:
+		return g.blockTargetName(template, relativeName, destinationName)
+	}
+	return destinationName, nil
+}
+
+// fileDigest hashes the content of the file, nil when it doesn't exist.
+func fileDigest(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// runOnChange runs the hooks of the template when its output changed,
+// showing their output on the template progress.
+func (g *generator) runOnChange(
+	i int,
+	template *templateFile,
+	outputName string,
+	before []byte,
+) error {
+	after, err := fileDigest(outputName)
+	if err != nil {
+		return err
+	}
+
+	if string(before) == string(after) {
+		return nil
+	}
+
+	if g.hookRunner == nil {
+		return errors.New("no hook runner configured for onChange hooks")
+	}
+
+	g.sleep()
+	g.notifyProgress(i, Hooking)
+
+	writer := &progressWriter{generator: g, i: i}
+	for _, hook := range template.onChange {
+		if err = g.hookRunner(hook.Script, writer); err != nil {
+			return fmt.Errorf("onChange hook %q: %w", hook.Script, err)
+		}
+	}
+
+	return nil
+}
+
+// progressWriter appends hook output to the progress of a template.
+type progressWriter struct {
+	generator *generator
+	i         int
+}
+
+func (w *progressWriter) Write(p []byte) (n int, err error) {
+	w.generator.updateProgress(w.i, func(templateProgress *TemplateProgress) {
+		templateProgress.Out = append(templateProgress.Out, p...)
+	})
+	return len(p), nil
+}
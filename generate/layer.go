@@ -0,0 +1,97 @@
+package generate
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// deleteMarkerSuffix marks a file in an overlay root that removes the file at
+// the same relative path from the roots below it, for example
+// `.vimrc.yconfig-delete`.
+const deleteMarkerSuffix = ".yconfig-delete"
+
+// initLayers selects the templates of every template root in order. A
+// template in a later root replaces the one at the same relative output path
+// in an earlier root and delete markers remove it altogether.
+func (g *generator) initLayers(matcher *alternateMatcher) (err error) {
+	layered := map[string]*templateFile{}
+
+	for _, root := range g.templateRoots {
+		var templates []*templateFile
+
+		files := glob(root, g.include, g.exclude)
+
+		markers := []string{}
+		unmarked := make([]string, 0, len(files))
+		for _, file := range files {
+			if strings.HasSuffix(file, deleteMarkerSuffix) {
+				markers = append(markers, file)
+			} else {
+				unmarked = append(unmarked, file)
+			}
+		}
+
+		if templates, err = selectAlternates(unmarked, matcher); err != nil {
+			return err
+		}
+
+		for _, marker := range markers {
+			delete(layered, g.markedRelativePath(root, marker))
+		}
+
+		for _, template := range templates {
+			template.root = root
+			if err = g.classifyTemplate(template); err != nil {
+				return err
+			}
+			layered[template.relativePath()] = template
+		}
+	}
+
+	relativePaths := make([]string, 0, len(layered))
+	for relativePath := range layered {
+		relativePaths = append(relativePaths, relativePath)
+	}
+	sort.Strings(relativePaths)
+
+	g.templates = make([]*templateFile, len(relativePaths))
+	for i, relativePath := range relativePaths {
+		g.templates[i] = layered[relativePath]
+	}
+
+	return nil
+}
+
+func (g *generator) markedRelativePath(root, marker string) string {
+	name := strings.TrimSuffix(marker, deleteMarkerSuffix)
+	name = strings.TrimSuffix(name, EncryptedSuffix)
+	if g.templateSuffix != "" {
+		name = strings.TrimSuffix(name, g.templateSuffix)
+	}
+	return getRelativePath(root, name)
+}
+
+// rootOf finds the template root containing name, defaulting to the top
+// most root.
+func (g *generator) rootOf(name string) string {
+	for i := len(g.templateRoots) - 1; i >= 0; i-- {
+		root := g.templateRoots[i]
+		relativePath, err := filepath.Rel(root, name)
+		if err == nil && !strings.HasPrefix(relativePath, "..") {
+			return root
+		}
+	}
+	return g.topRoot()
+}
+
+func (g *generator) topRoot() string {
+	if len(g.templateRoots) == 0 {
+		return "."
+	}
+	return g.templateRoots[len(g.templateRoots)-1]
+}
+
+func (t *templateFile) relativePath() string {
+	return getRelativePath(t.root, t.logicalPath)
+}
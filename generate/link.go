@@ -27,6 +27,12 @@ func getBackupName(name string, i int) (string, error) {
 	return getBackupName(name, i+1)
 }
 
+// BackupName is the first free name to move an existing file out of the way
+// to before linking over it.
+func BackupName(name string) (string, error) {
+	return getBackupName(name, 0)
+}
+
 func prepareLink(name string) error {
 	exists := fileExists(name)
 	lInfo, err1 := os.Lstat(name)
@@ -52,6 +58,38 @@ func prepareLink(name string) error {
 	return os.Rename(name, backupName)
 }
 
+// targetName is the file in the users home dir a template is linked to, or
+// the destination itself when linking is disabled.
+func (g *generator) targetName(
+	relativeName, destinationName string,
+) (string, error) {
+	if !g.link {
+		return destinationName, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, relativeName), nil
+}
+
+// removeLink removes the link in the users home dir when it points to the
+// generated file, leaving anything else in place.
+func removeLink(relativeName, destinationName string) error {
+	if !isLinked(relativeName, destinationName) {
+		return nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(filepath.Join(home, relativeName))
+}
+
 func makeLink(relativeName, destinationName string) error {
 	home, err1 := os.UserHomeDir()
 	if err1 != nil {
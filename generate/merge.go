@@ -0,0 +1,307 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	MergeFormatJSON = "json"
+	MergeFormatYAML = "yaml"
+	MergeFormatTOML = "toml"
+
+	MergeListsReplace = "replace"
+	MergeListsAppend  = "append"
+
+	mergeKeySeparator = "/"
+)
+
+// Merge renders the templates matching Glob as a structured document that is
+// deep merged into the existing target file instead of replacing or linking
+// it, keeping the keys the owning application added. Format is inferred from
+// the file extension when empty. Lists are either replaced (the default) or
+// appended to, skipping items already present. Delete lists key paths,
+// separated by a slash, to remove from the target.
+type Merge struct {
+	Glob   string
+	Format string
+	Lists  string
+	Delete []string
+}
+
+func findMerge(merges []*Merge, relativeName string) *Merge {
+	for _, m := range merges {
+		if globMatches(m.Glob, relativeName) {
+			return m
+		}
+	}
+	return nil
+}
+
+func (m *Merge) format(name string) (string, error) {
+	format := strings.ToLower(m.Format)
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	}
+
+	switch format {
+	case MergeFormatJSON, "jsonc":
+		return MergeFormatJSON, nil
+	case MergeFormatYAML, "yml":
+		return MergeFormatYAML, nil
+	case MergeFormatTOML:
+		return MergeFormatTOML, nil
+	}
+
+	return "", fmt.Errorf("unknown merge format for %s", name)
+}
+
+// mergeTemplate renders the template and merges it into the file in the users
+// home dir, or the destination when linking is disabled.
+func (g *generator) mergeTemplate(
+	template *templateFile,
+	relativeName, destinationName string,
+) error {
+	targetName, err := g.targetName(relativeName, destinationName)
+	if err != nil {
+		return err
+	}
+
+	format, err := template.merge.format(relativeName)
+	if err != nil {
+		return err
+	}
+
+	rendered := &bytes.Buffer{}
+	err = renderTemplate(
+		template,
+		rendered,
+		g.templateContext(),
+		g.renderOptions(),
+	)
+	if err != nil {
+		return err
+	}
+
+	src, err := decodeDocument(format, rendered.Bytes())
+	if err != nil {
+		return fmt.Errorf("rendered %s: %w", format, err)
+	}
+
+	if g.dryRun {
+		return nil
+	}
+
+	return mergeInto(targetName, format, src, template.merge)
+}
+
+func mergeInto(
+	targetName, format string,
+	src map[string]any,
+	merge *Merge,
+) error {
+	dst := map[string]any{}
+	perm := os.FileMode(0o644)
+
+	if content, err := os.ReadFile(targetName); err == nil {
+		if dst, err = decodeDocument(format, content); err != nil {
+			return fmt.Errorf("%s: %w", targetName, err)
+		}
+		if info, err := os.Stat(targetName); err == nil {
+			perm = info.Mode().Perm()
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	merged := mergeValues(dst, src, merge.Lists).(map[string]any)
+
+	for _, key := range merge.Delete {
+		deleteKey(merged, strings.Split(key, mergeKeySeparator))
+	}
+
+	content, err := encodeDocument(format, merged)
+	if err != nil {
+		return err
+	}
+
+	// a link left by a previous generate would write through to the
+	// generated file so it is replaced with a regular file
+	if info, err := os.Lstat(targetName); err == nil &&
+		info.Mode()&os.ModeSymlink != 0 {
+		if err = os.Remove(targetName); err != nil {
+			return err
+		}
+	}
+
+	if err = makeDirAll(targetName); err != nil {
+		return err
+	}
+
+	return os.WriteFile(targetName, content, perm)
+}
+
+func mergeValues(dst, src any, lists string) any {
+	switch src := src.(type) {
+	case map[string]any:
+		dstMap, ok := dst.(map[string]any)
+		if !ok {
+			return src
+		}
+		for key, value := range src {
+			dstMap[key] = mergeValues(dstMap[key], value, lists)
+		}
+		return dstMap
+	case []any:
+		dstSlice, ok := dst.([]any)
+		if !ok || lists != MergeListsAppend {
+			return src
+		}
+		for _, item := range src {
+			if !containsValue(dstSlice, item) {
+				dstSlice = append(dstSlice, item)
+			}
+		}
+		return dstSlice
+	}
+
+	return src
+}
+
+func containsValue(slice []any, value any) bool {
+	for _, item := range slice {
+		if reflect.DeepEqual(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func deleteKey(m map[string]any, keys []string) {
+	if len(keys) == 1 {
+		delete(m, keys[0])
+		return
+	}
+
+	if child, ok := m[keys[0]].(map[string]any); ok {
+		deleteKey(child, keys[1:])
+	}
+}
+
+// decodeDocument decodes a document of the format. JSON is read as JSONC, so
+// the comments and trailing commas allowed in files like the VS Code
+// settings.json are accepted, though not written back.
+func decodeDocument(format string, content []byte) (map[string]any, error) {
+	doc := map[string]any{}
+
+	if format == MergeFormatJSON {
+		content = stripJSONC(content)
+	}
+
+	if len(bytes.TrimSpace(content)) == 0 {
+		return doc, nil
+	}
+
+	var err error
+	switch format {
+	case MergeFormatJSON:
+		err = json.Unmarshal(content, &doc)
+	case MergeFormatYAML:
+		err = yaml.Unmarshal(content, &doc)
+	case MergeFormatTOML:
+		err = toml.Unmarshal(content, &doc)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// stripJSONC removes the // and /* */ comments and the trailing commas before
+// a closing bracket outside of strings.
+func stripJSONC(content []byte) []byte {
+	stripped := make([]byte, 0, len(content))
+	inString := false
+
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+
+		switch {
+		case inString:
+			stripped = append(stripped, c)
+			if c == '\\' && i+1 < len(content) {
+				i++
+				stripped = append(stripped, content[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			stripped = append(stripped, c)
+		case c == '/' && i+1 < len(content) && content[i+1] == '/':
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+			i--
+		case c == '/' && i+1 < len(content) && content[i+1] == '*':
+			end := bytes.Index(content[i+2:], []byte("*/"))
+			if end < 0 {
+				// left for the decoder to report
+				return append(stripped, content[i:]...)
+			}
+			i += end + 3
+			stripped = append(stripped, ' ')
+		case c == '}' || c == ']':
+			stripped = trimTrailingComma(stripped)
+			stripped = append(stripped, c)
+		default:
+			stripped = append(stripped, c)
+		}
+	}
+
+	return stripped
+}
+
+// trimTrailingComma drops a comma followed only by whitespace from the end.
+func trimTrailingComma(content []byte) []byte {
+	end := len(bytes.TrimRight(content, " \t\r\n"))
+	if end > 0 && content[end-1] == ',' {
+		return append(content[:end-1], content[end:]...)
+	}
+	return content
+}
+
+func encodeDocument(format string, doc map[string]any) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+
+	switch format {
+	case MergeFormatJSON:
+		encoder := json.NewEncoder(buffer)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+	case MergeFormatYAML:
+		encoder := yaml.NewEncoder(buffer)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+	case MergeFormatTOML:
+		if err := toml.NewEncoder(buffer).Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
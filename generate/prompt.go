@@ -0,0 +1,209 @@
+package generate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+type PromptKind int
+
+const (
+	PromptString PromptKind = iota
+	PromptBool
+	PromptChoice
+)
+
+// Prompt asks for a per machine value, like a work email, the first time a
+// template needs it. Default holds the kept answer when reprompting.
+type Prompt struct {
+	Key      string
+	Question string
+	Kind     PromptKind
+	Choices  []string
+	Default  string
+}
+
+// Prompter asks the user a prompt, returning the answer as a string.
+type Prompter func(prompt *Prompt) (answer string, err error)
+
+// PlaceholderPrompter answers every prompt with its default, the first
+// choice or an empty value, letting lint render templates without asking.
+func PlaceholderPrompter(prompt *Prompt) (string, error) {
+	switch {
+	case prompt.Default != "":
+		return prompt.Default, nil
+	case prompt.Kind == PromptBool:
+		return "false", nil
+	case prompt.Kind == PromptChoice && len(prompt.Choices) > 0:
+		return prompt.Choices[0], nil
+	}
+	return "", nil
+}
+
+// answers are the answers to prompts kept in a machine local yaml file,
+// loaded on first use.
+type answers struct {
+	name   string
+	values map[string]any
+	asked  map[string]bool
+	loaded bool
+	mutex  sync.Mutex
+}
+
+func newAnswers(name string) *answers {
+	return &answers{name: name, asked: map[string]bool{}}
+}
+
+func (a *answers) load() error {
+	if a.loaded {
+		return nil
+	}
+
+	a.values = map[string]any{}
+
+	if a.name != "" {
+		content, err := os.ReadFile(a.name)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err = yaml.Unmarshal(content, &a.values); err != nil {
+			return fmt.Errorf("%s: %w", a.name, err)
+		}
+	}
+
+	a.loaded = true
+
+	return nil
+}
+
+func (a *answers) save() error {
+	if a.name == "" {
+		return nil
+	}
+
+	content, err := yaml.Marshal(a.values)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(a.name), 0o700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(a.name, content, 0o600)
+}
+
+func (g *generator) promptString(key, question string) (string, error) {
+	return g.ask(&Prompt{Key: key, Question: question, Kind: PromptString})
+}
+
+func (g *generator) promptBool(key, question string) (bool, error) {
+	answer, err := g.ask(&Prompt{
+		Key:      key,
+		Question: question,
+		Kind:     PromptBool,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return strconv.ParseBool(answer)
+}
+
+func (g *generator) promptChoice(
+	key, question string,
+	choices ...string,
+) (string, error) {
+	if len(choices) == 0 {
+		return "", fmt.Errorf("prompt %s has no choices", key)
+	}
+
+	return g.ask(&Prompt{
+		Key:      key,
+		Question: question,
+		Kind:     PromptChoice,
+		Choices:  choices,
+	})
+}
+
+// ask returns the kept answer to the prompt or asks the prompter for one,
+// keeping it for later runs. Prompts are asked one at a time.
+func (g *generator) ask(prompt *Prompt) (answer string, err error) {
+	a := g.answers
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err = a.load(); err != nil {
+		return "", err
+	}
+
+	value, exists := a.values[prompt.Key]
+	if exists {
+		prompt.Default = fmt.Sprint(value)
+		if !g.reprompt || a.asked[prompt.Key] {
+			return prompt.Default, validateAnswer(prompt, prompt.Default)
+		}
+	}
+
+	if g.prompter == nil {
+		return "", fmt.Errorf(
+			"no answer for prompt %s, run generate in a terminal to answer it",
+			prompt.Key,
+		)
+	}
+
+	if answer, err = g.prompter(prompt); err != nil {
+		return "", err
+	}
+
+	if err = validateAnswer(prompt, answer); err != nil {
+		return "", err
+	}
+
+	a.asked[prompt.Key] = true
+	if prompt.Kind == PromptBool {
+		a.values[prompt.Key], _ = strconv.ParseBool(answer)
+	} else {
+		a.values[prompt.Key] = answer
+	}
+
+	if g.dryRun {
+		return answer, nil
+	}
+
+	return answer, a.save()
+}
+
+func validateAnswer(prompt *Prompt, answer string) error {
+	switch prompt.Kind {
+	case PromptBool:
+		if _, err := strconv.ParseBool(answer); err != nil {
+			return fmt.Errorf(
+				"answer %q to prompt %s is not a bool",
+				answer,
+				prompt.Key,
+			)
+		}
+	case PromptChoice:
+		for _, choice := range prompt.Choices {
+			if answer == choice {
+				return nil
+			}
+		}
+		return fmt.Errorf(
+			"answer %q to prompt %s is not one of %s",
+			answer,
+			prompt.Key,
+			strings.Join(prompt.Choices, ", "),
+		)
+	}
+
+	return nil
+}
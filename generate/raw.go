@@ -0,0 +1,140 @@
+package generate
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const binarySniffLen = 8000
+
+// Delims overrides the text/template action delimiters for the templates
+// matching Glob, relative to the template root.
+type Delims struct {
+	Glob  string
+	Left  string
+	Right string
+}
+
+// globMatches matches a per template option glob against either the logical
+// path relative to the template root, without any alternate or template
+// suffix, or just the file name.
+func globMatches(glob, relativeName string) bool {
+	if match, _ := filepath.Match(glob, relativeName); match {
+		return true
+	}
+
+	match, _ := filepath.Match(glob, filepath.Base(relativeName))
+
+	return match
+}
+
+func findDelims(delims []*Delims, relativeName string) *Delims {
+	for _, d := range delims {
+		if globMatches(d.Glob, relativeName) {
+			return d
+		}
+	}
+	return nil
+}
+
+// classifyTemplate decides whether a template is rendered or copied as is.
+// When a template suffix is configured only files ending with it are rendered
+// and the suffix is stripped from the output name. Binary files are always
+// copied and encrypted files are decrypted.
+func (g *generator) classifyTemplate(template *templateFile) (err error) {
+	if strings.HasSuffix(template.logicalPath, EncryptedSuffix) {
+		template.logicalPath = strings.TrimSuffix(
+			template.logicalPath,
+			EncryptedSuffix,
+		)
+		template.encrypted = true
+		template.raw = true
+	} else if g.templateSuffix != "" {
+		if strings.HasSuffix(template.logicalPath, g.templateSuffix) {
+			template.logicalPath = strings.TrimSuffix(
+				template.logicalPath,
+				g.templateSuffix,
+			)
+		} else {
+			template.raw = true
+		}
+	}
+
+	if !template.raw {
+		if template.raw, err = isBinary(template.path); err != nil {
+			return err
+		}
+	}
+
+	relativeName := template.relativePath()
+	template.delims = findDelims(g.delims, relativeName)
+	template.merge = findMerge(g.merges, relativeName)
+	template.block = findBlock(g.blocks, relativeName)
+	template.onChange = findOnChange(g.onChange, relativeName)
+
+	return nil
+}
+
+func isBinary(name string) (binary bool, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, binarySniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+
+	return bytes.IndexByte(buf[:n], 0) >= 0, nil
+}
+
+func copyFile(sourceName, destinationName string) (err error) {
+	if err = prepareDestination(destinationName); err != nil {
+		return err
+	}
+
+	source, err := os.Open(sourceName)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	destination, err := os.OpenFile(
+		destinationName,
+		os.O_CREATE|os.O_WRONLY|os.O_TRUNC,
+		info.Mode().Perm(),
+	)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	if _, err = io.Copy(destination, source); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func copyTo(sourceName string, writer io.Writer) (err error) {
+	source, err := os.Open(sourceName)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	_, err = io.Copy(writer, source)
+
+	return err
+}
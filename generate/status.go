@@ -0,0 +1,100 @@
+package generate
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+)
+
+type TemplateKind int
+
+const (
+	KindTemplate TemplateKind = iota
+	KindRaw
+	KindMerge
+	KindBlock
+	KindEncrypted
+)
+
+func (k TemplateKind) String() string {
+	switch k {
+	case KindTemplate:
+		return "template"
+	case KindRaw:
+		return "raw"
+	case KindMerge:
+		return "merge"
+	case KindBlock:
+		return "block"
+	case KindEncrypted:
+		return "encrypted"
+	}
+	return "unknown"
+}
+
+// TemplateStatus describes where a selected template comes from and what it
+// generates, without generating anything.
+type TemplateStatus struct {
+	Path   string
+	Root   string
+	Output string
+	Kind   TemplateKind
+	Linked bool
+}
+
+func (g *generator) Status() (statuses []*TemplateStatus, err error) {
+	g.prepare()
+
+	if err = g.initTempalates(); err != nil {
+		return nil, err
+	}
+
+	statuses = make([]*TemplateStatus, len(g.templates))
+	for i, template := range g.templates {
+		relativeName := template.relativePath()
+		destinationName := path.Join(g.destinationRoot, relativeName)
+
+		status := &TemplateStatus{
+			Path:   template.path,
+			Root:   template.root,
+			Output: relativeName,
+		}
+
+		switch {
+		case template.merge != nil:
+			status.Kind = KindMerge
+		case template.block != nil:
+			status.Kind = KindBlock
+		case template.encrypted:
+			status.Kind = KindEncrypted
+		case template.raw:
+			status.Kind = KindRaw
+		default:
+			status.Kind = KindTemplate
+		}
+
+		if status.Kind != KindMerge && status.Kind != KindBlock {
+			status.Linked = isLinked(relativeName, destinationName)
+		}
+
+		statuses[i] = status
+	}
+
+	return statuses, nil
+}
+
+func isLinked(relativeName, destinationName string) bool {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return false
+	}
+
+	absName, err := filepath.Abs(destinationName)
+	if err != nil {
+		return false
+	}
+
+	target, err := os.Readlink(filepath.Join(home, relativeName))
+
+	return err == nil && target == absName
+}
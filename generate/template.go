@@ -1,14 +1,16 @@
 package generate
 
 import (
+	"errors"
+	"io"
 	"os"
-	"runtime"
 	"strings"
 	"text/template"
 )
 
 type TemplateContext struct {
 	OS   string
+	Arch string
 	Tags map[string]bool
 }
 
@@ -21,36 +23,119 @@ func (c *TemplateContext) NotForTag(tag string) bool {
 	return !c.ForTag(tag)
 }
 
+type renderOptions struct {
+	strict  bool
+	dryRun  bool
+	funcs   template.FuncMap
+	decrypt func(content []byte) ([]byte, error)
+}
+
+func (g *generator) renderOptions() *renderOptions {
+	return &renderOptions{
+		strict:  g.strict,
+		funcs:   g.templateFuncs(),
+		decrypt: g.decrypt,
+	}
+}
+
+func (g *generator) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"secret": func(key string) (string, error) {
+			if g.secrets == nil {
+				return "", errors.New("no secret providers configured")
+			}
+			return g.secrets.Get(key)
+		},
+		"promptString": g.promptString,
+		"promptBool":   g.promptBool,
+		"promptChoice": g.promptChoice,
+	}
+}
+
 func generateTemplate(
-	templateName, destinationName string,
-	tags map[string]bool,
+	templateFile *templateFile,
+	destinationName string,
+	context *TemplateContext,
+	options *renderOptions,
 ) error {
+	if options.dryRun && templateFile.encrypted {
+		// decrypting needs the passphrase, which lint and dry runs may not
+		// have
+		return nil
+	}
+
+	if options.dryRun {
+		return renderTemplate(templateFile, io.Discard, context, options)
+	}
+
+	if templateFile.encrypted {
+		return decryptFile(templateFile.path, destinationName, options)
+	}
+
+	if templateFile.raw {
+		return copyFile(templateFile.path, destinationName)
+	}
+
 	if err := prepareDestination(destinationName); err != nil {
 		return err
 	}
 
-	t, err1 := template.ParseFiles(templateName)
-	if err1 != nil {
-		return err1
+	f, err := os.Create(destinationName)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
 
-	f, err2 := os.Create(destinationName)
-	if err2 != nil {
-		return err2
+	return renderTemplate(templateFile, f, context, options)
+}
+
+func renderTemplate(
+	templateFile *templateFile,
+	writer io.Writer,
+	context *TemplateContext,
+	options *renderOptions,
+) error {
+	if templateFile.encrypted {
+		return decryptTo(templateFile.path, writer, options)
 	}
-	defer f.Close()
 
-	context := &TemplateContext{
-		OS:   runtime.GOOS,
-		Tags: tags,
+	if templateFile.raw {
+		return copyTo(templateFile.path, writer)
 	}
 
-	err3 := t.Execute(f, context)
-	if err3 != nil {
-		return err3
+	t, err := parseTemplate(templateFile, options)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return t.Execute(writer, context)
+}
+
+func parseTemplate(
+	templateFile *templateFile,
+	options *renderOptions,
+) (*template.Template, error) {
+	content, err := os.ReadFile(templateFile.path)
+	if err != nil {
+		return nil, err
+	}
+
+	// naming the template after its path makes parse and exec errors report
+	// the file and line that failed
+	t := template.New(templateFile.path)
+	if templateFile.delims != nil {
+		t.Delims(templateFile.delims.Left, templateFile.delims.Right)
+	}
+
+	if options.funcs != nil {
+		t.Funcs(options.funcs)
+	}
+
+	if options.strict {
+		t.Option("missingkey=error")
+	}
+
+	return t.Parse(string(content))
 }
 
 func prepareDestination(destinationName string) error {
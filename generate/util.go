@@ -3,10 +3,15 @@ package generate
 import (
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 )
 
 func getRelativePath(root, name string) string {
+	if relativePath, err := filepath.Rel(root, name); err == nil {
+		return relativePath
+	}
+
 	relativePath := strings.TrimPrefix(name, root)
 	relativePath = strings.TrimPrefix(relativePath, "/")
 
@@ -310,6 +310,7 @@ func TagsGet(
 	}
 
 	for _, tag := range rawTags {
+		tag = strings.ToLower(tag)
 		if strings.HasSuffix(tag, "!") {
 			normalizedTag := tag[:len(tag)-1]
 			requiredTags.Put(normalizedTag)
@@ -0,0 +1,79 @@
+package secret
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Terminal runs a command that may read from the terminal, like one asking
+// for a passphrase, while something else such as a progress view owns it.
+type Terminal func(command *exec.Cmd) error
+
+// CommandProvider runs a command with the key appended to its args and reads
+// the value from stdout, as with `pass show` or `op read`. A single trailing
+// newline is trimmed. Exiting with one of the not found exit codes moves on
+// to the next provider.
+type CommandProvider struct {
+	name              string
+	cmd               string
+	args              []string
+	notFoundExitCodes []int
+	terminal          Terminal
+}
+
+func (p *CommandProvider) Name() string {
+	return p.name
+}
+
+func (p *CommandProvider) Get(key string) (string, error) {
+	args := make([]string, 0, len(p.args)+1)
+	args = append(args, p.args...)
+	args = append(args, key)
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	command := exec.Command(p.cmd, args...)
+	command.Env = os.Environ()
+	command.Stdout = stdout
+	command.Stderr = stderr
+
+	var err error
+	if p.terminal != nil {
+		// stdin is left unset for the terminal to hand over
+		err = p.terminal(command)
+	} else {
+		command.Stdin = os.Stdin
+		err = command.Run()
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && p.isNotFound(exitErr.ExitCode()) {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", fmt.Errorf(
+			"%s: %w: %s",
+			p.cmd,
+			err,
+			strings.TrimSpace(stderr.String()),
+		)
+	}
+
+	value := strings.TrimSuffix(stdout.String(), "\n")
+	value = strings.TrimSuffix(value, "\r")
+
+	return value, nil
+}
+
+func (p *CommandProvider) isNotFound(exitCode int) bool {
+	for _, notFound := range p.notFoundExitCodes {
+		if exitCode == notFound {
+			return true
+		}
+	}
+	return false
+}
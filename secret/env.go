@@ -0,0 +1,30 @@
+package secret
+
+import (
+	"os"
+	"strings"
+)
+
+var envReplacer = strings.NewReplacer("/", "_", "-", "_", ".", "_")
+
+// EnvProvider reads secrets from environment variables. The key npm/token is
+// read from the variable PREFIX_NPM_TOKEN.
+type EnvProvider struct {
+	name   string
+	prefix string
+}
+
+func (p *EnvProvider) Name() string {
+	return p.name
+}
+
+func (p *EnvProvider) Get(key string) (string, error) {
+	envName := p.prefix + strings.ToUpper(envReplacer.Replace(key))
+
+	value, exists := os.LookupEnv(envName)
+	if !exists {
+		return "", ErrNotFound
+	}
+
+	return value, nil
+}
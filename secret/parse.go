@@ -0,0 +1,194 @@
+package secret
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yo3jones/yconfig/parse"
+)
+
+const (
+	TypeEnv     = "env"
+	TypeCommand = "command"
+	TypeStore   = "store"
+
+	DefaultPassphraseEnv = "YCONFIG_PASSPHRASE"
+)
+
+// UnmarshalProviders builds the providers from the secrets.providers config,
+// a list of maps with a name and a type of env, command or store. The type is
+// inferred from the cmd and path keys when missing.
+func UnmarshalProviders(a *any) (providers []Provider, err error) {
+	if a == nil || *a == nil {
+		return []Provider{}, nil
+	}
+
+	var slicePtr *[]any
+	if slicePtr, err = parse.Cast[[]any](a); err != nil {
+		return nil, err
+	}
+
+	providers = make([]Provider, len(*slicePtr))
+	for i, providerAny := range *slicePtr {
+		var m *map[string]any
+		if m, err = parse.Cast[map[string]any](&providerAny); err != nil {
+			return nil, err
+		}
+		if providers[i], err = unmarshalProvider(m); err != nil {
+			return nil, err
+		}
+	}
+
+	return providers, nil
+}
+
+func unmarshalProvider(m *map[string]any) (provider Provider, err error) {
+	var (
+		t      string
+		name   string
+		exists bool
+	)
+
+	if t, exists, err = parse.StringGet(m, "type"); err != nil {
+		return nil, err
+	} else if !exists {
+		t = inferType(m)
+	}
+
+	if name, exists, err = parse.StringGet(m, "name"); err != nil {
+		return nil, err
+	} else if !exists {
+		name = t
+	}
+
+	switch t {
+	case TypeEnv:
+		p := &EnvProvider{name: name}
+		if p.prefix, _, err = parse.StringGet(m, "prefix"); err != nil {
+			return nil, err
+		}
+		return p, nil
+	case TypeCommand:
+		p := &CommandProvider{name: name}
+		if p.cmd, exists, err = parse.StringGet(m, "cmd"); err != nil {
+			return nil, err
+		} else if !exists {
+			return nil, fmt.Errorf("command secret provider requires field cmd")
+		}
+		if p.args, _, err = parse.StringSliceGet(m, "args"); err != nil {
+			return nil, err
+		}
+		if p.notFoundExitCodes, err = exitCodesGet(m); err != nil {
+			return nil, err
+		}
+		return p, nil
+	case TypeStore:
+		return unmarshalStoreProvider(name, m)
+	}
+
+	return nil, fmt.Errorf("unknown secret provider type %s", t)
+}
+
+func unmarshalStoreProvider(
+	name string,
+	m *map[string]any,
+) (provider Provider, err error) {
+	var (
+		path          string
+		keyFile       string
+		passphraseEnv string
+		exists        bool
+	)
+
+	if path, exists, err = parse.StringGet(m, "path"); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, fmt.Errorf("store secret provider requires field path")
+	}
+
+	if keyFile, _, err = parse.StringGet(m, "keyFile"); err != nil {
+		return nil, err
+	}
+
+	passphraseEnv, exists, err = parse.StringGet(m, "passphraseEnv")
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		passphraseEnv = DefaultPassphraseEnv
+	}
+
+	return NewStoreProvider(
+		name,
+		path,
+		PassphraseFunc(keyFile, passphraseEnv),
+	), nil
+}
+
+// exitCodesGet reads notFoundExitCodes, a list of the exit codes a command
+// uses for unknown keys, like 1 for `pass show`.
+func exitCodesGet(m *map[string]any) (exitCodes []int, err error) {
+	slice, exists, err := parse.Get[[]any](m, "notFoundExitCodes")
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	exitCodes = make([]int, len(*slice))
+	for i, exitCode := range *slice {
+		var exitCodePtr *int
+		if exitCodePtr, err = parse.Cast[int](&exitCode); err != nil {
+			return nil, err
+		}
+		exitCodes[i] = *exitCodePtr
+	}
+
+	return exitCodes, nil
+}
+
+func inferType(m *map[string]any) string {
+	if _, exists := (*m)["cmd"]; exists {
+		return TypeCommand
+	}
+	if _, exists := (*m)["path"]; exists {
+		return TypeStore
+	}
+	return TypeEnv
+}
+
+// PassphraseFunc reads the store passphrase from the key file when given,
+// otherwise from the environment variable.
+func PassphraseFunc(keyFile, passphraseEnv string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		if keyFile != "" {
+			content, err := os.ReadFile(ExpandHome(keyFile))
+			if err != nil {
+				return nil, err
+			}
+			return bytes.TrimSpace(content), nil
+		}
+
+		if passphrase, exists := os.LookupEnv(passphraseEnv); exists {
+			return []byte(passphrase), nil
+		}
+
+		return nil, fmt.Errorf(
+			"no passphrase for the secrets store, set %s or a key file",
+			passphraseEnv,
+		)
+	}
+}
+
+func ExpandHome(name string) string {
+	if !strings.HasPrefix(name, "~/") {
+		return name
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return name
+	}
+
+	return filepath.Join(home, name[2:])
+}
@@ -0,0 +1,123 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const providerSeparator = ":"
+
+var ErrNotFound = errors.New("secret not found")
+
+// Provider looks up secret values by key, returning ErrNotFound when it
+// doesn't know the key.
+type Provider interface {
+	Name() string
+	Get(key string) (value string, err error)
+}
+
+// Secrets resolves keys against an ordered list of providers and caches the
+// values for the rest of the run. A key may select a provider by name with a
+// prefix, as in `pass:npm/token`, otherwise the first provider knowing the key
+// wins.
+type Secrets struct {
+	providers []Provider
+	cache     map[string]string
+	mutex     sync.Mutex
+}
+
+func New(providers ...Provider) *Secrets {
+	return &Secrets{
+		providers: providers,
+		cache:     map[string]string{},
+	}
+}
+
+// Terminal sets how command providers run while something else owns the
+// terminal.
+func (s *Secrets) Terminal(terminal Terminal) *Secrets {
+	for _, provider := range s.providers {
+		if command, ok := provider.(*CommandProvider); ok {
+			command.terminal = terminal
+		}
+	}
+	return s
+}
+
+func (s *Secrets) Get(key string) (value string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if value, exists := s.cache[key]; exists {
+		return value, nil
+	}
+
+	if value, err = s.lookup(key); err != nil {
+		return "", err
+	}
+
+	s.cache[key] = value
+
+	return value, nil
+}
+
+// Values returns every secret value resolved so far, used to redact them from
+// output.
+func (s *Secrets) Values() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	values := make([]string, 0, len(s.cache))
+	for _, value := range s.cache {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func (s *Secrets) lookup(key string) (value string, err error) {
+	if name, providerKey, found := strings.Cut(key, providerSeparator); found {
+		for _, provider := range s.providers {
+			if provider.Name() == name {
+				return provider.Get(providerKey)
+			}
+		}
+	}
+
+	for _, provider := range s.providers {
+		value, err = provider.Get(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf(
+				"secret %s from %s: %w",
+				key,
+				provider.Name(),
+				err,
+			)
+		}
+		return value, nil
+	}
+
+	return "", fmt.Errorf("secret %s: %w", key, ErrNotFound)
+}
+
+type placeholder struct{}
+
+// Placeholder is a provider returning a stand in value for every key, used to
+// render templates without access to the real secrets.
+func Placeholder() Provider {
+	return &placeholder{}
+}
+
+func (p *placeholder) Name() string {
+	return "placeholder"
+}
+
+func (p *placeholder) Get(key string) (string, error) {
+	return fmt.Sprintf("<secret %s>", key), nil
+}
@@ -0,0 +1,288 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	storeVersion = 1
+	storeKdf     = "scrypt"
+	saltLen      = 16
+	keyLen       = 32
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	// limits on the kdf parameters read from an envelope, so a crafted file
+	// can't make Open use unbounded memory or time.
+	maxScryptN      = 1 << 20
+	maxScryptR      = 16
+	maxScryptP      = 16
+	maxScryptMemory = 1 << 30
+)
+
+var ErrDecrypt = errors.New(
+	"unable to decrypt, wrong passphrase or key file",
+)
+
+// storeEnvelope is the on disk format of the store and encrypted files. Only
+// the kdf parameters are in the clear, the contents are sealed with
+// AES-256-GCM using a key derived from the passphrase with scrypt.
+type storeEnvelope struct {
+	Version int    `json:"version"`
+	Kdf     string `json:"kdf"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// Store is an encrypted key value file that is safe to commit alongside the
+// config.
+type Store struct {
+	path       string
+	passphrase []byte
+	secrets    map[string]string
+}
+
+// NewStore creates an empty store that is written to path on Save.
+func NewStore(path string, passphrase []byte) *Store {
+	return &Store{
+		path:       path,
+		passphrase: passphrase,
+		secrets:    map[string]string{},
+	}
+}
+
+// OpenStore reads and decrypts the store at path.
+func OpenStore(path string, passphrase []byte) (store *Store, err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := Open(content, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	store = NewStore(path, passphrase)
+	if err = json.Unmarshal(plain, &store.secrets); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Open decrypts content sealed with Seal.
+func Open(content, passphrase []byte) (plain []byte, err error) {
+	envelope := &storeEnvelope{}
+	if err = json.Unmarshal(content, envelope); err != nil {
+		return nil, err
+	}
+
+	if envelope.Version != storeVersion || envelope.Kdf != storeKdf {
+		return nil, fmt.Errorf(
+			"unsupported encryption version %d with kdf %s",
+			envelope.Version,
+			envelope.Kdf,
+		)
+	}
+
+	if err = checkKdfParameters(envelope); err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key(
+		passphrase,
+		envelope.Salt,
+		envelope.N,
+		envelope.R,
+		envelope.P,
+		keyLen,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err = gcm.Open(nil, envelope.Nonce, envelope.Data, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plain, nil
+}
+
+// checkKdfParameters bounds the scrypt parameters, which take 128 * N * R
+// bytes of memory.
+func checkKdfParameters(envelope *storeEnvelope) error {
+	if envelope.N <= 1 || envelope.N > maxScryptN ||
+		envelope.R <= 0 || envelope.R > maxScryptR ||
+		envelope.P <= 0 || envelope.P > maxScryptP ||
+		128*envelope.N*envelope.R > maxScryptMemory {
+		return fmt.Errorf(
+			"unsupported kdf parameters n %d, r %d and p %d",
+			envelope.N,
+			envelope.R,
+			envelope.P,
+		)
+	}
+
+	return nil
+}
+
+func (s *Store) Get(key string) (value string, exists bool) {
+	value, exists = s.secrets[key]
+	return value, exists
+}
+
+func (s *Store) Set(key, value string) {
+	s.secrets[key] = value
+}
+
+func (s *Store) Delete(key string) (exists bool) {
+	_, exists = s.secrets[key]
+	delete(s.secrets, key)
+	return exists
+}
+
+func (s *Store) Keys() []string {
+	keys := make([]string, 0, len(s.secrets))
+	for key := range s.secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Save encrypts the store with a fresh salt and nonce and writes it to its
+// path.
+func (s *Store) Save() (err error) {
+	plain, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+
+	content, err := Seal(plain, s.passphrase)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.path, content, 0o600)
+}
+
+// Rekey changes the passphrase used by the next Save.
+func (s *Store) Rekey(passphrase []byte) {
+	s.passphrase = passphrase
+}
+
+// Seal encrypts plain with a key derived from the passphrase, using a fresh
+// salt and nonce each time.
+func Seal(plain, passphrase []byte) (content []byte, err error) {
+	envelope := &storeEnvelope{
+		Version: storeVersion,
+		Kdf:     storeKdf,
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+		Salt:    make([]byte, saltLen),
+	}
+
+	if _, err = rand.Read(envelope.Salt); err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key(
+		passphrase,
+		envelope.Salt,
+		envelope.N,
+		envelope.R,
+		envelope.P,
+		keyLen,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(envelope.Nonce); err != nil {
+		return nil, err
+	}
+
+	envelope.Data = gcm.Seal(nil, envelope.Nonce, plain, nil)
+
+	if content, err = json.MarshalIndent(envelope, "", "  "); err != nil {
+		return nil, err
+	}
+
+	return append(content, '\n'), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// StoreProvider serves secrets from an encrypted store, opened on first use.
+type StoreProvider struct {
+	name       string
+	path       string
+	passphrase func() ([]byte, error)
+	store      *Store
+}
+
+func NewStoreProvider(
+	name, path string,
+	passphrase func() ([]byte, error),
+) *StoreProvider {
+	return &StoreProvider{name: name, path: path, passphrase: passphrase}
+}
+
+func (p *StoreProvider) Name() string {
+	return p.name
+}
+
+func (p *StoreProvider) Get(key string) (string, error) {
+	if p.store == nil {
+		passphrase, err := p.passphrase()
+		if err != nil {
+			return "", err
+		}
+
+		if p.store, err = OpenStore(p.path, passphrase); err != nil {
+			return "", err
+		}
+	}
+
+	value, exists := p.store.Get(key)
+	if !exists {
+		return "", ErrNotFound
+	}
+
+	return value, nil
+}
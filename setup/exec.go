@@ -6,10 +6,18 @@ import (
 	"os/exec"
 )
 
-func Exec(cmd string, args []string, writer io.Writer) (err error) {
+func Exec(
+	cmd string,
+	args []string,
+	env []string,
+	dir string,
+	writer io.Writer,
+) (err error) {
 	command := exec.Command(cmd, args...)
 
-	command.Env = os.Environ()
+	command.Dir = dir
+
+	command.Env = append(os.Environ(), env...)
 
 	command.Stdout = writer
 	command.Stderr = writer
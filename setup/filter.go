@@ -16,6 +16,8 @@ type Filterable interface {
 }
 
 type Filterer interface {
+	Os(os string) Filterer
+	Arch(arch string) Filterer
 	Tags(tags *set.Set[string]) Filterer
 	EntryNames(entryNames *set.Set[string]) Filterer
 	FilterSystemScripts(
@@ -24,10 +26,15 @@ type Filterer interface {
 	FilterSystemPackageManagers(
 		packageManagers []*SystemPackageManager,
 	) (systemPackageManager *SystemPackageManager, err error)
+	FilterNamedPackageManagers(
+		packageManagers []*SystemPackageManager,
+	) (systemPackageManagers map[string]*SystemPackageManager, err error)
 	FilterEntries(groups []*EntryGroup) (values []*Entry, err error)
 }
 
 type filterer struct {
+	osName            string
+	archName          string
 	runtimeOs         ostypes.Os
 	runtimeArch       archtypes.Arch
 	runtimeTags       *set.Set[string]
@@ -44,6 +51,18 @@ func NewFilterer() Filterer {
 	return &filterer{initialized: false}
 }
 
+func (f *filterer) Os(os string) Filterer {
+	f.osName = os
+	f.initialized = false
+	return f
+}
+
+func (f *filterer) Arch(arch string) Filterer {
+	f.archName = arch
+	f.initialized = false
+	return f
+}
+
 func (f *filterer) Tags(tags *set.Set[string]) Filterer {
 	f.runtimeTags = tags
 	f.initialized = false
@@ -68,14 +87,19 @@ func (f *filterer) FilterSystemScripts(
 	}
 }
 
+// FilterSystemPackageManagers picks the default package manager for the
+// system out of the ones without a name.
 func (f *filterer) FilterSystemPackageManagers(
 	packageManagers []*SystemPackageManager,
 ) (systemPackageManager *SystemPackageManager, err error) {
-	foundPackageManager, found, err := filter(
-		f,
-		packageManagers,
-		nonRestrictive,
-	)
+	unnamed := make([]*SystemPackageManager, 0, len(packageManagers))
+	for _, packageManager := range packageManagers {
+		if packageManager.Name == "" {
+			unnamed = append(unnamed, packageManager)
+		}
+	}
+
+	foundPackageManager, found, err := filter(f, unnamed, nonRestrictive)
 	if err != nil {
 		return nil, err
 	} else if !found {
@@ -85,6 +109,33 @@ func (f *filterer) FilterSystemPackageManagers(
 	}
 }
 
+// FilterNamedPackageManagers picks a package manager for the system per
+// name, the default one under the empty name. Names without a package
+// manager for the system are left out.
+func (f *filterer) FilterNamedPackageManagers(
+	packageManagers []*SystemPackageManager,
+) (systemPackageManagers map[string]*SystemPackageManager, err error) {
+	byName := map[string][]*SystemPackageManager{}
+	for _, packageManager := range packageManagers {
+		byName[packageManager.Name] = append(
+			byName[packageManager.Name],
+			packageManager,
+		)
+	}
+
+	systemPackageManagers = make(map[string]*SystemPackageManager, len(byName))
+	for name, named := range byName {
+		foundPackageManager, found, err := filter(f, named, nonRestrictive)
+		if err != nil {
+			return nil, err
+		} else if found {
+			systemPackageManagers[name] = foundPackageManager
+		}
+	}
+
+	return systemPackageManagers, nil
+}
+
 func (f *filterer) FilterEntries(
 	groups []*EntryGroup,
 ) (entries []*Entry, err error) {
@@ -121,11 +172,21 @@ func (f *filterer) initialize() (err error) {
 		return nil
 	}
 
-	if f.runtimeOs, err = ostypes.OsFromString(runtime.GOOS); err != nil {
+	osName := f.osName
+	if osName == "" {
+		osName = runtime.GOOS
+	}
+
+	archName := f.archName
+	if archName == "" {
+		archName = runtime.GOARCH
+	}
+
+	if f.runtimeOs, err = ostypes.OsFromString(osName); err != nil {
 		return err
 	}
 
-	f.runtimeArch, err = archtypes.ArchFromString(runtime.GOARCH)
+	f.runtimeArch, err = archtypes.ArchFromString(archName)
 	if err != nil {
 		return err
 	}
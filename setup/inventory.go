@@ -0,0 +1,132 @@
+package setup
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Inventory compares the packages a package manager reports as explicitly
+// installed with the packages of the selected package entries using it.
+type Inventory struct {
+	Manager            string
+	MissingFromConfig  []string
+	MissingFromMachine []string
+}
+
+// Inventory lists the packages of every package manager with a list script
+// for the system, ordered by package manager name.
+func (s *setuper) Inventory() (inventories []*Inventory, err error) {
+	if err = s.prepare(); err != nil {
+		return nil, err
+	}
+
+	configured := map[string]map[string]bool{}
+	for _, entry := range s.entries {
+		commander, ok := entry.commander.(*PackageEntry)
+		if !ok {
+			continue
+		}
+		if configured[commander.manager] == nil {
+			configured[commander.manager] = map[string]bool{}
+		}
+		for _, pkg := range commander.packages {
+			configured[commander.manager][pkg.Name] = true
+		}
+	}
+
+	names := make([]string, 0, len(s.systemPackageManagers))
+	for name, pm := range s.systemPackageManagers {
+		if pm.ListScript != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no package manager with a listScript found")
+	}
+
+	for _, name := range names {
+		var installed map[string]bool
+		installed, err = s.listInstalled(s.systemPackageManagers[name])
+		if err != nil && name == "" {
+			return nil, fmt.Errorf("listing packages: %w", err)
+		} else if err != nil {
+			return nil, fmt.Errorf("listing %s packages: %w", name, err)
+		}
+
+		inventories = append(
+			inventories,
+			newInventory(name, configured[name], installed),
+		)
+	}
+
+	return inventories, nil
+}
+
+func newInventory(
+	manager string,
+	configured, installed map[string]bool,
+) *Inventory {
+	inventory := &Inventory{
+		Manager:            manager,
+		MissingFromConfig:  []string{},
+		MissingFromMachine: []string{},
+	}
+
+	for pkg := range installed {
+		if !configured[pkg] {
+			inventory.MissingFromConfig = append(
+				inventory.MissingFromConfig,
+				pkg,
+			)
+		}
+	}
+
+	for pkg := range configured {
+		if !installed[pkg] {
+			inventory.MissingFromMachine = append(
+				inventory.MissingFromMachine,
+				pkg,
+			)
+		}
+	}
+
+	sort.Strings(inventory.MissingFromConfig)
+	sort.Strings(inventory.MissingFromMachine)
+
+	return inventory
+}
+
+// listInstalled runs the list script, taking the first field of every line
+// of its output as a package name.
+func (s *setuper) listInstalled(
+	pm *SystemPackageManager,
+) (installed map[string]bool, err error) {
+	cmd, args := s.systemScript.BuildCommand(pm.ListScript)
+
+	stderr := &bytes.Buffer{}
+	command := exec.Command(cmd, args...)
+	command.Dir = s.dir
+	command.Stderr = stderr
+
+	out, err := command.Output()
+	if message := strings.TrimSpace(stderr.String()); err != nil &&
+		message != "" {
+		return nil, fmt.Errorf("%w: %s", err, message)
+	} else if err != nil {
+		return nil, err
+	}
+
+	installed = map[string]bool{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			installed[fields[0]] = true
+		}
+	}
+
+	return installed, nil
+}
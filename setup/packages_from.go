@@ -0,0 +1,157 @@
+package setup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/yo3jones/yconfig/secret"
+)
+
+const (
+	PackagesFormatBrewfile = "brewfile"
+	PackagesFormatList     = "list"
+	PackagesFormatDpkg     = "dpkg"
+)
+
+var brewfileLine = regexp.MustCompile(`^\s*(brew|cask|tap)\s+["']([^"']+)["']`)
+
+// PackageManifest is what was read from a package manifest. Taps only come
+// from a Brewfile and aren't packages, they are left to the caller.
+type PackageManifest struct {
+	Format   string
+	Packages []*Package
+	Taps     []string
+}
+
+// ReadPackageManifest reads a Brewfile, a newline delimited list or the
+// output of dpkg --get-selections. The format is detected when empty.
+func ReadPackageManifest(name, format string) (*PackageManifest, error) {
+	content, err := os.ReadFile(secret.ExpandHome(name))
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "" {
+		format = DetectPackagesFormat(name, content)
+	}
+
+	manifest := &PackageManifest{Format: format}
+	lines := strings.Split(string(content), "\n")
+
+	switch format {
+	case PackagesFormatBrewfile:
+		manifest.Packages, manifest.Taps = parseBrewfile(lines)
+	case PackagesFormatList:
+		manifest.Packages = parsePackageList(lines)
+	case PackagesFormatDpkg:
+		manifest.Packages = parseDpkgSelections(lines)
+	default:
+		return nil, fmt.Errorf(
+			"unknown packages format %s, use %s, %s or %s",
+			format,
+			PackagesFormatBrewfile,
+			PackagesFormatList,
+			PackagesFormatDpkg,
+		)
+	}
+
+	return manifest, nil
+}
+
+// DetectPackagesFormat treats files named like a Brewfile as one, content
+// where every line is a package and its selection state as dpkg selections
+// and anything else as a list.
+func DetectPackagesFormat(name string, content []byte) string {
+	base := filepath.Base(name)
+	if base == "Brewfile" ||
+		strings.HasPrefix(base, "Brewfile.") ||
+		strings.HasSuffix(base, ".Brewfile") {
+		return PackagesFormatBrewfile
+	}
+
+	dpkg := false
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 || !isDpkgSelection(fields[1]) {
+			return PackagesFormatList
+		}
+		dpkg = true
+	}
+
+	if dpkg {
+		return PackagesFormatDpkg
+	}
+
+	return PackagesFormatList
+}
+
+func isDpkgSelection(selection string) bool {
+	switch selection {
+	case "install", "hold", "deinstall", "purge":
+		return true
+	}
+	return false
+}
+
+// parseBrewfile reads the brew, cask and tap lines, casks are installed with
+// the --cask flag.
+func parseBrewfile(lines []string) (packages []*Package, taps []string) {
+	for _, line := range lines {
+		match := brewfileLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		switch match[1] {
+		case "brew":
+			packages = append(packages, &Package{Name: match[2]})
+		case "cask":
+			packages = append(
+				packages,
+				&Package{Name: match[2], Flags: []string{"--cask"}},
+			)
+		case "tap":
+			taps = append(taps, match[2])
+		}
+	}
+
+	return packages, taps
+}
+
+// parsePackageList takes the first field of every line, skipping blank
+// lines and comments.
+func parsePackageList(lines []string) (packages []*Package) {
+	for _, line := range lines {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		if fields := strings.Fields(line); len(fields) > 0 {
+			packages = append(packages, &Package{Name: fields[0]})
+		}
+	}
+
+	return packages
+}
+
+// parseDpkgSelections takes the packages selected to be installed or held.
+func parseDpkgSelections(lines []string) (packages []*Package) {
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		if fields[1] == "install" || fields[1] == "hold" {
+			packages = append(packages, &Package{Name: fields[0]})
+		}
+	}
+
+	return packages
+}
@@ -57,3 +57,33 @@ func retryBehaviorGetDefaultMap(
 
 	return retryBehaviorGet(defaults, key)
 }
+
+// secretsGetDefaultMap reads a map of environment variable names to secret
+// keys.
+func secretsGetDefaultMap(
+	m *map[string]any,
+	key string,
+	defaults *map[string]any,
+) (secrets map[string]string, err error) {
+	var rawSecrets *map[string]any
+
+	rawSecrets, _, err = parse.GetDefaultMap[map[string]any](m, key, defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets = map[string]string{}
+	if rawSecrets == nil {
+		return secrets, nil
+	}
+
+	for envName, rawKey := range *rawSecrets {
+		var secretKey *string
+		if secretKey, err = parse.Cast[string](&rawKey); err != nil {
+			return nil, err
+		}
+		secrets[envName] = *secretKey
+	}
+
+	return secrets, nil
+}
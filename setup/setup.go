@@ -2,9 +2,14 @@ package setup
 
 import (
 	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
+	"github.com/yo3jones/yconfig/generate"
+	"github.com/yo3jones/yconfig/secret"
 	"github.com/yo3jones/yconfig/set"
 )
 
@@ -13,11 +18,21 @@ type Setuper interface {
 	PackageManagersConfig(packageManagersConfig *any) Setuper
 	Config(config *any) Setuper
 	Tags(tags []string) Setuper
+	Os(os string) Setuper
+	Arch(arch string) Setuper
+	Mode(mode Mode) Setuper
+	Dir(dir string) Setuper
+	DryRun(dryRun bool) Setuper
+	Secrets(secrets *secret.Secrets) Setuper
+	Generator(newGenerator func() (generate.Generator, error)) Setuper
 	EntryNames(entryNames []string) Setuper
+	Filter(filter func(entry *Entry) bool) Setuper
+	BatchPackages(batchPackages bool) Setuper
 	HideCompletedOut(hideCompletedOut bool) Setuper
 	Delay(delay int) Setuper
 	OnProgress(onProgress func(setupState *SetupState)) Setuper
 	Setup() (err error)
+	Inventory() (inventories []*Inventory, err error)
 }
 
 type setuper struct {
@@ -25,7 +40,16 @@ type setuper struct {
 	packageManagersConfig *any
 	config                *any
 	tags                  *set.Set[string]
+	os                    string
+	arch                  string
+	mode                  Mode
+	dir                   string
+	dryRun                bool
+	secrets               *secret.Secrets
+	newGenerator          func() (generate.Generator, error)
 	entryNames            *set.Set[string]
+	entryFilter           func(entry *Entry) bool
+	batchPackages         bool
 	hideCompletedOut      bool
 	delay                 int
 	onProgress            func(setupState *SetupState)
@@ -33,7 +57,7 @@ type setuper struct {
 	packageManagers       []*SystemPackageManager
 	groups                []*EntryGroup
 	systemScript          *SystemScript
-	systemPackageManager  *SystemPackageManager
+	systemPackageManagers map[string]*SystemPackageManager
 	entries               []*Entry
 	state                 *SetupState
 }
@@ -46,6 +70,7 @@ const (
 	StatusRunning
 	StatusComplete
 	StatusError
+	StatusSatisfied
 )
 
 func (s Status) String() string {
@@ -58,6 +83,8 @@ func (s Status) String() string {
 		return "complete"
 	case StatusError:
 		return "error"
+	case StatusSatisfied:
+		return "satisfied"
 	}
 
 	return "unknown"
@@ -69,6 +96,8 @@ func (s Status) IsCompleted() bool {
 		return true
 	case StatusError:
 		return true
+	case StatusSatisfied:
+		return true
 	default:
 		return false
 	}
@@ -86,6 +115,18 @@ type SetupState struct {
 	HideCompletedOut bool
 }
 
+// AppliedCount is the number of entries that completed or were already
+// satisfied, leaving out errors that setup continued past.
+func (s *SetupState) AppliedCount() int {
+	count := 0
+	for _, state := range s.EntryStates {
+		if state.Status == StatusComplete || state.Status == StatusSatisfied {
+			count++
+		}
+	}
+	return count
+}
+
 type EntryState struct {
 	Entry            *Entry
 	Status           Status
@@ -93,6 +134,7 @@ type EntryState struct {
 	Retrying         bool
 	Out              []byte
 	HideCompletedOut bool
+	unbatched        bool
 }
 
 func New() Setuper {
@@ -103,8 +145,35 @@ func (s *setuper) Script() *SystemScript {
 	return s.systemScript
 }
 
-func (s *setuper) PackageManager() *SystemPackageManager {
-	return s.systemPackageManager
+// PackageManager is the package manager with the name for the system, the
+// default one when the name is empty.
+func (s *setuper) PackageManager(name string) *SystemPackageManager {
+	return s.systemPackageManagers[name]
+}
+
+func (s *setuper) entryPackageManager(entry *Entry) *SystemPackageManager {
+	commander, ok := entry.commander.(*PackageEntry)
+	if !ok {
+		return nil
+	}
+	return s.systemPackageManagers[commander.manager]
+}
+
+// SetupMode is whether package entries are installed, upgraded or removed.
+func (s *setuper) SetupMode() Mode {
+	return s.mode
+}
+
+// Platform is the os and arch setup runs for, which may be overridden.
+func (s *setuper) Platform() (os, arch string) {
+	os, arch = s.os, s.arch
+	if os == "" {
+		os = runtime.GOOS
+	}
+	if arch == "" {
+		arch = runtime.GOARCH
+	}
+	return os, arch
 }
 
 func (s *setuper) ScriptsConfig(scriptsConfig *any) Setuper {
@@ -122,16 +191,111 @@ func (s *setuper) Config(config *any) Setuper {
 	return s
 }
 
+// Tags sets the runtime tags, matched case insensitively like the tags of
+// generate.
 func (s *setuper) Tags(tags []string) Setuper {
-	s.tags = set.New(tags...)
+	s.tags = set.New[string]()
+	for _, tag := range tags {
+		s.tags.Put(strings.ToLower(tag))
+	}
+	return s
+}
+
+func (s *setuper) Os(os string) Setuper {
+	s.os = os
+	return s
+}
+
+// Mode drives package entries through the install, upgrade or remove script
+// of the package manager. Other entries are skipped unless removing and they
+// have their own remove script.
+func (s *setuper) Mode(mode Mode) Setuper {
+	s.mode = mode
+	return s
+}
+
+// Dir is where commands run and relative paths of entries resolve, the
+// working directory when empty.
+func (s *setuper) Dir(dir string) Setuper {
+	s.dir = dir
 	return s
 }
 
+// Path expands the home dir of a path from an entry and resolves it against
+// the setup dir when relative.
+func (s *setuper) Path(name string) string {
+	name = secret.ExpandHome(name)
+	if s.dir == "" || name == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(s.dir, name)
+}
+
+func (s *setuper) Arch(arch string) Setuper {
+	s.arch = arch
+	return s
+}
+
+func (s *setuper) DryRun(dryRun bool) Setuper {
+	s.dryRun = dryRun
+	return s
+}
+
+func (s *setuper) Secrets(secrets *secret.Secrets) Setuper {
+	s.secrets = secrets
+	return s
+}
+
+// Generator sets how template entries get a generator configured like the
+// generate command.
+func (s *setuper) Generator(
+	newGenerator func() (generate.Generator, error),
+) Setuper {
+	s.newGenerator = newGenerator
+	return s
+}
+
+// NewGenerator returns a configured generator rendering for the os, arch and
+// tags setup runs with.
+func (s *setuper) NewGenerator() (generate.Generator, error) {
+	if s.newGenerator == nil {
+		return nil, fmt.Errorf("no generator configured for template entries")
+	}
+
+	generator, err := s.newGenerator()
+	if err != nil {
+		return nil, err
+	}
+
+	os, arch := s.Platform()
+	generator.Os(os).Arch(arch)
+
+	if s.tags != nil && s.tags.Len() > 0 {
+		generator.Tags(s.tags.Iter())
+	}
+
+	return generator, nil
+}
+
 func (s *setuper) EntryNames(entryNames []string) Setuper {
 	s.entryNames = set.New(entryNames...)
 	return s
 }
 
+// Filter further narrows down the entries selected for the os, arch, tags
+// and names.
+func (s *setuper) Filter(filter func(entry *Entry) bool) Setuper {
+	s.entryFilter = filter
+	return s
+}
+
+// BatchPackages installs consecutive package entries in one package manager
+// invocation, as when the package manager sets batch.
+func (s *setuper) BatchPackages(batchPackages bool) Setuper {
+	s.batchPackages = batchPackages
+	return s
+}
+
 func (s *setuper) HideCompletedOut(hideCompletedOut bool) Setuper {
 	s.hideCompletedOut = hideCompletedOut
 	return s
@@ -152,6 +316,9 @@ func (s *setuper) Setup() (err error) {
 		return err
 	}
 
+	// completes right away when no entries were selected
+	s.recalculateState()
+
 	s.notifyProgress()
 
 	if err = s.execAll(); err != nil {
@@ -180,6 +347,14 @@ func (s *setuper) prepare() (err error) {
 	// s.systemPackageManager.Print()
 	// SlicePrint(s.values)
 
+	if err = s.readPackagesFrom(); err != nil {
+		return err
+	}
+
+	if err = s.checkPackageManagers(); err != nil {
+		return err
+	}
+
 	s.prepareState()
 
 	return nil
@@ -206,6 +381,8 @@ func (s *setuper) unmarshalConfigs() (err error) {
 
 func (s *setuper) filter() (err error) {
 	filterer := NewFilterer().
+		Os(s.os).
+		Arch(s.arch).
 		Tags(s.tags).
 		EntryNames(s.entryNames)
 
@@ -214,7 +391,7 @@ func (s *setuper) filter() (err error) {
 		return err
 	}
 
-	s.systemPackageManager, err = filterer.FilterSystemPackageManagers(
+	s.systemPackageManagers, err = filterer.FilterNamedPackageManagers(
 		s.packageManagers,
 	)
 	if err != nil {
@@ -225,6 +402,104 @@ func (s *setuper) filter() (err error) {
 		return err
 	}
 
+	if s.mode != ModeInstall {
+		s.filterMode()
+	}
+
+	if s.entryFilter != nil {
+		entries := make([]*Entry, 0, len(s.entries))
+		for _, entry := range s.entries {
+			if s.entryFilter(entry) {
+				entries = append(entries, entry)
+			}
+		}
+		s.entries = entries
+	}
+
+	return nil
+}
+
+// filterMode keeps the package entries and, when removing, the entries with
+// a remove script. Removing goes in reverse so entries are removed before
+// what they were installed after.
+func (s *setuper) filterMode() {
+	entries := make([]*Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		_, isPackage := entry.commander.(*PackageEntry)
+		if isPackage || (s.mode == ModeRemove && entry.Remove != "") {
+			entries = append(entries, entry)
+		}
+	}
+
+	if s.mode == ModeRemove {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+
+	s.entries = entries
+}
+
+// readPackagesFrom reads the manifests of the selected package entries.
+func (s *setuper) readPackagesFrom() error {
+	for _, entry := range s.entries {
+		commander, ok := entry.commander.(*PackageEntry)
+		if !ok {
+			continue
+		}
+		if err := commander.readPackagesFrom(s); err != nil {
+			return fmt.Errorf("setup entry %s: %w", entry.Name, err)
+		}
+	}
+	return nil
+}
+
+// checkPackageManagers makes sure every package entry has a package manager
+// for the system that can run the mode before any entry runs.
+func (s *setuper) checkPackageManagers() error {
+	for _, entry := range s.entries {
+		commander, ok := entry.commander.(*PackageEntry)
+		if !ok {
+			continue
+		}
+
+		pm := s.systemPackageManagers[commander.manager]
+		switch {
+		case pm == nil && commander.manager == "":
+			return fmt.Errorf("no system package manager found")
+		case pm == nil:
+			return fmt.Errorf(
+				"no package manager %s found for setup entry %s",
+				commander.manager,
+				entry.Name,
+			)
+		case pm.ModeScript(s.mode) == "":
+			return fmt.Errorf(
+				"setup entry %s needs a %sScript on its package manager",
+				entry.Name,
+				s.mode,
+			)
+		case s.mode == ModeInstall && len(commander.taps) > 0 &&
+			pm.TapScript == "":
+			return fmt.Errorf(
+				"setup entry %s reads taps from %s but its package manager "+
+					"has no tapScript",
+				entry.Name,
+				commander.packagesFrom,
+			)
+		case pm.format == nil && hasPackageVersions(commander.packages):
+			return fmt.Errorf(
+				"setup entry %s pins versions but its package manager has "+
+					"no packageFormat",
+				entry.Name,
+			)
+		}
+
+		_, _, err := pm.BuildCommand(s.systemScript, s.mode, commander.packages)
+		if err != nil {
+			return fmt.Errorf("setup entry %s: %w", entry.Name, err)
+		}
+	}
 	return nil
 }
 
@@ -259,6 +534,16 @@ func (s *setuper) execAll() (err error) {
 			i = 0
 		}
 
+		if batch := s.batchFrom(i); len(batch) > 1 {
+			if s.execBatch(batch) {
+				i += len(batch) - 1
+			} else {
+				// run the same entries again one at a time
+				i--
+			}
+			continue
+		}
+
 		state := s.state.EntryStates[i]
 
 		if err = s.exec(state); err != nil {
@@ -269,6 +554,171 @@ func (s *setuper) execAll() (err error) {
 	return nil
 }
 
+// batchFrom collects the consecutive package entries starting at i that can
+// be installed together, which need the same package manager.
+func (s *setuper) batchFrom(i int) (batch []*EntryState) {
+	pm := s.entryPackageManager(s.state.EntryStates[i].Entry)
+	if pm == nil || (!s.batchPackages && !pm.Batch) {
+		return nil
+	}
+
+	for ; i < len(s.state.EntryStates); i++ {
+		state := s.state.EntryStates[i]
+		if s.entryPackageManager(state.Entry) != pm ||
+			state.Status != StatusWaiting ||
+			state.Tries > 0 ||
+			state.unbatched ||
+			hasPackageFlags(state.Entry.commander.(*PackageEntry).packages) ||
+			len(state.Entry.Secrets) > 0 {
+			break
+		}
+		batch = append(batch, state)
+	}
+
+	return batch
+}
+
+// execBatch installs the packages of all the entries in one invocation. When
+// it fails the entries are marked to be installed one at a time, so the
+// failure is attributed to the right entry.
+func (s *setuper) execBatch(batch []*EntryState) (ok bool) {
+	s.doDelay()
+
+	for _, state := range batch {
+		state.Status = StatusRunning
+	}
+	s.recalculateState()
+	s.notifyProgress()
+
+	pm := s.entryPackageManager(batch[0].Entry)
+
+	packages := []*Package{}
+	taps := []string{}
+	pending := make([]*EntryState, 0, len(batch))
+	writers := make([]io.Writer, 0, len(batch))
+	for _, state := range batch {
+		writer := NewWriter(&state.Out, s.secretValues(), s.notifyProgress)
+
+		commander := state.Entry.commander.(*PackageEntry)
+		missing := s.checkPackages(pm, commander.packages, writer)
+		if len(missing) == 0 {
+			state.Tries++
+			s.changeStatus(state, StatusSatisfied)
+			continue
+		}
+
+		packages = append(packages, missing...)
+		taps = append(taps, commander.taps...)
+		pending = append(pending, state)
+		writers = append(writers, writer)
+	}
+
+	if len(pending) == 0 {
+		return true
+	}
+
+	writer := io.MultiWriter(writers...)
+
+	var (
+		cmd  string
+		args []string
+	)
+	err := s.tap(pm, taps, writer)
+	if err == nil {
+		cmd, args, err = pm.BuildCommand(s.systemScript, s.mode, packages)
+	}
+	if err != nil {
+		fmt.Fprintln(writer, err)
+	} else {
+		fmt.Fprintf(writer, "%s %s\n\n", cmd, strings.Join(args, " "))
+	}
+
+	if err == nil && !s.dryRun {
+		err = Exec(cmd, args, nil, s.dir, writer)
+	}
+
+	for _, state := range pending {
+		if err != nil {
+			state.unbatched = true
+			state.Status = StatusWaiting
+		} else {
+			state.Tries++
+			state.Status = StatusComplete
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(
+			writer,
+			"%s\n\nbatch install failed, installing one at a time\n\n",
+			err,
+		)
+	} else {
+		s.doDelay()
+	}
+
+	s.recalculateState()
+	s.notifyProgress()
+
+	return err == nil
+}
+
+// tap adds the taps read from a Brewfile before installing its packages.
+func (s *setuper) tap(
+	pm *SystemPackageManager,
+	taps []string,
+	writer io.Writer,
+) error {
+	if s.mode != ModeInstall || len(taps) == 0 {
+		return nil
+	}
+
+	cmd, args := pm.BuildTapCommand(s.systemScript, taps)
+
+	fmt.Fprintf(writer, "%s %s\n\n", cmd, strings.Join(args, " "))
+
+	if s.dryRun {
+		return nil
+	}
+
+	return Exec(cmd, args, nil, s.dir, writer)
+}
+
+// checkPackages runs the check script of the package manager for every
+// package and returns the ones the mode applies to, the ones not installed
+// yet when installing and the installed ones otherwise. Packages are checked
+// by name, the check script compares a pinned version when it is a template.
+func (s *setuper) checkPackages(
+	pm *SystemPackageManager,
+	packages []*Package,
+	writer io.Writer,
+) (missing []*Package) {
+	if s.dryRun || pm.CheckScript == "" {
+		return packages
+	}
+
+	for _, pkg := range packages {
+		cmd, args, err := pm.BuildCheckCommand(s.systemScript, pkg)
+		if err != nil {
+			fmt.Fprintln(writer, err)
+			missing = append(missing, pkg)
+			continue
+		}
+
+		installed := Exec(cmd, args, nil, s.dir, io.Discard) == nil
+
+		if installed != (s.mode == ModeInstall) {
+			missing = append(missing, pkg)
+		} else if installed {
+			fmt.Fprintf(writer, "%s is already installed\n", pkg.Name)
+		} else {
+			fmt.Fprintf(writer, "%s is not installed\n", pkg.Name)
+		}
+	}
+
+	return missing
+}
+
 func (s *setuper) exec(state *EntryState) (err error) {
 	if state.Status.IsCompleted() {
 		return nil
@@ -295,14 +745,58 @@ func (s *setuper) execOnce(state *EntryState) (err error) {
 
 	s.changeStatus(state, StatusRunning)
 
-	cmd, args := state.Entry.commander.BuildCommand(s)
-	writer := NewWriter(&state.Out, func() {
+	_, isPackage := state.Entry.commander.(*PackageEntry)
+	removeScript := s.mode == ModeRemove && !isPackage
+
+	var (
+		cmd  string
+		args []string
+	)
+	if removeScript {
+		cmd, args = s.systemScript.BuildCommand(state.Entry.Remove)
+	} else {
+		cmd, args, err = state.Entry.commander.BuildCommand(s)
+	}
+
+	var env []string
+	if !s.dryRun && err == nil {
+		env, err = s.secretsEnv(state.Entry)
+	}
+
+	writer := NewWriter(&state.Out, s.secretValues(), func() {
 		s.notifyProgress()
 	})
 
+	if entry, ok := state.Entry.commander.(*PackageEntry); ok && err == nil {
+		pm := s.PackageManager(entry.manager)
+		missing := s.checkPackages(pm, entry.packages, writer)
+		if len(missing) == 0 {
+			state.Tries++
+			s.doDelay()
+			s.changeStatus(state, StatusSatisfied)
+			return nil
+		}
+		// only the packages still needing the mode are passed
+		if err = s.tap(pm, entry.taps, writer); err == nil {
+			cmd, args, err = pm.BuildCommand(s.systemScript, s.mode, missing)
+		}
+	}
+
 	fmt.Fprintf(writer, "%s %s\n\n", cmd, strings.Join(args, " "))
 
-	err = Exec(cmd, args, writer)
+	if err != nil {
+		fmt.Fprintln(writer, err)
+	} else if runner, ok := state.Entry.commander.(EntryRunner); ok &&
+		!removeScript {
+		if !s.dryRun {
+			err = runner.Run(s, writer)
+		}
+		if err != nil {
+			fmt.Fprintln(writer, err)
+		}
+	} else if !s.dryRun {
+		err = Exec(cmd, args, env, s.dir, writer)
+	}
 
 	state.Tries++
 
@@ -329,6 +823,35 @@ func (s *setuper) execOnce(state *EntryState) (err error) {
 	return nil
 }
 
+// secretsEnv resolves the secrets of the entry into environment variables.
+func (s *setuper) secretsEnv(entry *Entry) (env []string, err error) {
+	if len(entry.Secrets) == 0 {
+		return nil, nil
+	}
+
+	if s.secrets == nil {
+		return nil, fmt.Errorf("no secret providers configured")
+	}
+
+	env = make([]string, 0, len(entry.Secrets))
+	for envName, key := range entry.Secrets {
+		var value string
+		if value, err = s.secrets.Get(key); err != nil {
+			return nil, err
+		}
+		env = append(env, fmt.Sprintf("%s=%s", envName, value))
+	}
+
+	return env, nil
+}
+
+func (s *setuper) secretValues() []string {
+	if s.secrets == nil {
+		return nil
+	}
+	return s.secrets.Values()
+}
+
 func (s *setuper) doDelay() {
 	if s.delay <= 0 {
 		return
@@ -355,7 +878,7 @@ func (s *setuper) recalculateState() {
 		case StatusWaiting:
 		case StatusRunning:
 			setupStatus = StatusRunning
-		case StatusComplete:
+		case StatusComplete, StatusSatisfied:
 			completedCount++
 		case StatusError:
 			erroredCount++
@@ -30,6 +30,9 @@ const (
 	TypePackage
 	TypeCommand
 	TypeGit
+	TypeDownload
+	TypeLink
+	TypeTemplate
 )
 
 func (t Type) String() string {
@@ -42,6 +45,12 @@ func (t Type) String() string {
 		return "command"
 	case TypeGit:
 		return "git"
+	case TypeDownload:
+		return "download"
+	case TypeLink:
+		return "link"
+	case TypeTemplate:
+		return "template"
 	}
 	return "unknown"
 }
@@ -56,10 +65,52 @@ func TypeFromString(str string) (Type, error) {
 		return TypeCommand, nil
 	case "git":
 		return TypeGit, nil
+	case "download":
+		return TypeDownload, nil
+	case "link":
+		return TypeLink, nil
+	case "template":
+		return TypeTemplate, nil
 	}
 	return TypeUnknown, fmt.Errorf("no setup type for string %s", str)
 }
 
+// Mode is what setup does with package entries.
+type Mode int
+
+const (
+	ModeInstall Mode = iota
+	ModeUpgrade
+	ModeRemove
+)
+
+func (mode Mode) String() string {
+	switch mode {
+	case ModeInstall:
+		return "install"
+	case ModeUpgrade:
+		return "upgrade"
+	case ModeRemove:
+		return "remove"
+	}
+	return "unknown"
+}
+
+func ModeFromString(str string) (Mode, error) {
+	switch str {
+	case "install", "":
+		return ModeInstall, nil
+	case "upgrade":
+		return ModeUpgrade, nil
+	case "remove":
+		return ModeRemove, nil
+	}
+	return ModeInstall, fmt.Errorf(
+		"no setup mode for string %s, use install, upgrade or remove",
+		str,
+	)
+}
+
 type Printer interface {
 	Print()
 }
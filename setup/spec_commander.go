@@ -8,7 +8,7 @@ import (
 )
 
 type EntryCommander interface {
-	BuildCommand(system System) (cmd string, args []string)
+	BuildCommand(system System) (cmd string, args []string, err error)
 }
 
 type EntryCommanderUnmarshaler interface {
@@ -19,7 +19,7 @@ type EntryCommanderUnmarshaler interface {
 
 func unmarshalEntryString(str *string) *Entry {
 	commander := &PackageEntry{
-		packages: []string{*str},
+		packages: []*Package{{Name: *str}},
 	}
 	return NewEntry(*str, commander)
 }
@@ -55,6 +55,12 @@ func inferEntryType(m *map[string]any) (t Type, exists bool, err error) {
 		return TypePackage, true, nil
 	}
 
+	if _, exists, err = parse.Get[any](m, "packagesFrom"); err != nil {
+		return t, false, err
+	} else if exists {
+		return TypePackage, true, nil
+	}
+
 	if _, exists, err = parse.Get[any](m, "script"); err != nil {
 		return t, false, err
 	} else if exists {
@@ -73,6 +79,24 @@ func inferEntryType(m *map[string]any) (t Type, exists bool, err error) {
 		return TypeGit, true, nil
 	}
 
+	if _, exists, err = parse.Get[any](m, "url"); err != nil {
+		return t, false, err
+	} else if exists {
+		return TypeDownload, true, nil
+	}
+
+	if _, exists, err = parse.Get[any](m, "src"); err != nil {
+		return t, false, err
+	} else if exists {
+		return TypeLink, true, nil
+	}
+
+	if _, exists, err = parse.Get[any](m, "templates"); err != nil {
+		return t, false, err
+	} else if exists {
+		return TypeTemplate, true, nil
+	}
+
 	return t, false, nil
 }
 
@@ -86,28 +110,92 @@ func newEntryCommander(t Type) (EntryCommanderUnmarshaler, error) {
 		return &CommandEntry{}, nil
 	case TypeGit:
 		return &GitEntry{}, nil
+	case TypeDownload:
+		return &DownloadEntry{}, nil
+	case TypeLink:
+		return &LinkEntry{}, nil
+	case TypeTemplate:
+		return &TemplateEntry{}, nil
 	}
 	return nil, fmt.Errorf("unable to instantiate entry for type %s", t)
 }
 
+// PackageEntry installs packages through the default package manager of
+// the system or the one named by manager, after adding the taps with its tap
+// script. Packages may also be read from a manifest like a Brewfile with
+// packagesFrom, relative to the setup dir.
 type PackageEntry struct {
-	packages []string
+	packages       []*Package
+	manager        string
+	packagesFrom   string
+	packagesFormat string
+	taps           []string
 }
 
 func (e *PackageEntry) unmarshalMapDefaults(
 	m, defaults *map[string]any,
 ) (err error) {
-	e.packages, _, err = parse.StringSliceGetDefaultMap(m, "packages", defaults)
+	e.packages, err = packagesGetDefaultMap(m, "packages", defaults)
+	if err != nil {
+		return err
+	}
+	e.manager, _, err = parse.StringGetDefaultMap(m, "manager", defaults)
+	if err != nil {
+		return err
+	}
+	e.taps, _, err = parse.StringSliceGetDefaultMap(m, "taps", defaults)
+	if err != nil {
+		return err
+	}
+
+	e.packagesFrom, _, err = parse.StringGetDefaultMap(
+		m,
+		"packagesFrom",
+		defaults,
+	)
+	if err != nil {
+		return err
+	}
+	e.packagesFormat, _, err = parse.StringGetDefaultMap(
+		m,
+		"packagesFormat",
+		defaults,
+	)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// readPackagesFrom adds the packages and taps of the packagesFrom manifest.
+func (e *PackageEntry) readPackagesFrom(system System) error {
+	if e.packagesFrom == "" {
+		return nil
+	}
+
+	manifest, err := ReadPackageManifest(
+		system.Path(e.packagesFrom),
+		e.packagesFormat,
+	)
+	if err != nil {
+		return fmt.Errorf("reading packagesFrom %s: %w", e.packagesFrom, err)
+	}
+
+	e.packages = append(e.packages, manifest.Packages...)
+	e.taps = append(e.taps, manifest.Taps...)
+
+	return nil
+}
+
+// BuildCommand builds the package manager command for every package.
 func (e *PackageEntry) BuildCommand(
 	system System,
-) (cmd string, args []string) {
-	return system.PackageManager().BuildCommand(system.Script(), e.packages)
+) (cmd string, args []string, err error) {
+	return system.PackageManager(e.manager).BuildCommand(
+		system.Script(),
+		system.SetupMode(),
+		e.packages,
+	)
 }
 
 type GitEntry struct {
@@ -223,7 +311,7 @@ func (e *GitEntry) unmarshalMapDefaults(
 
 func (e *GitEntry) BuildCommand(
 	system System,
-) (cmd string, args []string) {
+) (cmd string, args []string, err error) {
 	repo := e.repo
 	if !strings.HasPrefix(strings.ToLower(repo), "https://") {
 		repo = fmt.Sprintf("https://github.com/%s", repo)
@@ -248,7 +336,8 @@ func (e *GitEntry) BuildCommand(
 		script = fmt.Sprintf("rm -rf %s \\\n; %s", e.dest, script)
 	}
 
-	return system.Script().BuildCommand(script)
+	cmd, args = system.Script().BuildCommand(script)
+	return cmd, args, nil
 }
 
 type ScriptEntry struct {
@@ -269,8 +358,9 @@ func (e *ScriptEntry) unmarshalMapDefaults(
 
 func (e *ScriptEntry) BuildCommand(
 	system System,
-) (cmd string, args []string) {
-	return system.Script().BuildCommand(e.script)
+) (cmd string, args []string, err error) {
+	cmd, args = system.Script().BuildCommand(e.script)
+	return cmd, args, nil
 }
 
 type CommandEntry struct {
@@ -296,6 +386,6 @@ func (e *CommandEntry) unmarshalMapDefaults(
 
 func (e *CommandEntry) BuildCommand(
 	system System,
-) (cmd string, args []string) {
-	return e.cmd, e.args
+) (cmd string, args []string, err error) {
+	return e.cmd, e.args, nil
 }
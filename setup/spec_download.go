@@ -0,0 +1,605 @@
+package setup
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ulikunitz/xz"
+	"github.com/yo3jones/yconfig/parse"
+)
+
+const (
+	ExtractNone  = ""
+	ExtractTarGz = "tar.gz"
+	ExtractTarXz = "tar.xz"
+	ExtractZip   = "zip"
+
+	downloadProgressStep = 10
+)
+
+// downloadClient gives up on servers that stop responding, while leaving
+// large downloads on a slow connection enough time to finish.
+var downloadClient = &http.Client{
+	Timeout:   time.Hour,
+	Transport: downloadTransport(),
+}
+
+func downloadTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSHandshakeTimeout = 30 * time.Second
+	transport.ResponseHeaderTimeout = time.Minute
+	return transport
+}
+
+// DownloadEntry downloads a file natively, verifies its checksum and either
+// writes it to dest or extracts it into dest. The url may use {{ .OS }} and
+// {{ .Arch }}. Mode is the mode of a file written to dest, extracted files
+// keep the mode they have in the archive.
+type DownloadEntry struct {
+	url             string
+	sha256          string
+	extract         string
+	stripComponents int
+	dest            string
+	mode            os.FileMode
+}
+
+// EntryRunner is implemented by entries that run natively instead of through
+// the command they build, which is then only shown in the output.
+type EntryRunner interface {
+	Run(system System, writer io.Writer) (err error)
+}
+
+type downloadContext struct {
+	OS   string
+	Arch string
+}
+
+func (e *DownloadEntry) unmarshalMapDefaults(
+	m, defaults *map[string]any,
+) (err error) {
+	var exists bool
+
+	e.url, exists, err = parse.StringGetDefaultMap(m, "url", defaults)
+	if err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("download setup entry requires field url")
+	}
+
+	e.dest, exists, err = parse.StringGetDefaultMap(m, "dest", defaults)
+	if err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("download setup entry requires field dest")
+	}
+
+	e.sha256, _, err = parse.StringGetDefaultMap(m, "sha256", defaults)
+	if err != nil {
+		return err
+	}
+	e.sha256 = strings.ToLower(e.sha256)
+
+	e.extract, _, err = parse.StringGetDefaultMap(m, "extract", defaults)
+	if err != nil {
+		return err
+	}
+	switch e.extract {
+	case ExtractNone, ExtractTarGz, ExtractTarXz, ExtractZip:
+	default:
+		return fmt.Errorf(
+			"download setup entry can't extract %s, use %s, %s or %s",
+			e.extract,
+			ExtractTarGz,
+			ExtractTarXz,
+			ExtractZip,
+		)
+	}
+
+	e.stripComponents, _, err = parse.IntGetDefaultMap(
+		m,
+		"stripComponents",
+		defaults,
+	)
+	if err != nil {
+		return err
+	}
+
+	if e.mode, err = modeGetDefaultMap(m, "mode", defaults); err != nil {
+		return err
+	}
+
+	if e.mode != 0 && e.extract != ExtractNone {
+		return fmt.Errorf(
+			"download setup entry mode only applies when not extracting",
+		)
+	}
+
+	return nil
+}
+
+// modeGetDefaultMap reads a file mode given either as an octal string like
+// "0755" or as a number.
+func modeGetDefaultMap(
+	m *map[string]any,
+	key string,
+	defaults *map[string]any,
+) (mode os.FileMode, err error) {
+	raw, exists, err := parse.GetDefaultMap[any](m, key, defaults)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	switch raw := (*raw).(type) {
+	case int:
+		return os.FileMode(raw), nil
+	case string:
+		parsed, err := strconv.ParseUint(raw, 8, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid mode %s: %w", raw, err)
+		}
+		return os.FileMode(parsed), nil
+	}
+
+	return 0, fmt.Errorf(
+		"mode must be an octal string or int but got %T",
+		*raw,
+	)
+}
+
+func (e *DownloadEntry) BuildCommand(
+	system System,
+) (cmd string, args []string, err error) {
+	url, err := e.renderURL(system)
+	if err != nil {
+		url = e.url
+	}
+
+	args = []string{url, e.dest}
+	if e.extract != ExtractNone {
+		args = append(args, "--extract", e.extract)
+	}
+
+	return "download", args, nil
+}
+
+func (e *DownloadEntry) renderURL(system System) (string, error) {
+	t, err := template.New("url").Option("missingkey=error").Parse(e.url)
+	if err != nil {
+		return "", err
+	}
+
+	osName, archName := system.Platform()
+
+	sb := &strings.Builder{}
+	err = t.Execute(sb, &downloadContext{OS: osName, Arch: archName})
+	if err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
+
+func (e *DownloadEntry) Run(system System, writer io.Writer) (err error) {
+	url, err := e.renderURL(system)
+	if err != nil {
+		return err
+	}
+
+	dest := system.Path(e.dest)
+
+	if err = os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+
+	// downloaded next to dest so the final rename stays on one filesystem
+	temp, err := os.CreateTemp(filepath.Dir(dest), ".yconfig-download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	digest, err := download(url, temp, writer)
+	if err != nil {
+		return err
+	}
+
+	if e.sha256 != "" && digest != e.sha256 {
+		return fmt.Errorf(
+			"sha256 mismatch, expected %s but got %s",
+			e.sha256,
+			digest,
+		)
+	} else if e.sha256 != "" {
+		fmt.Fprintf(writer, "verified sha256 %s\n", digest)
+	} else {
+		fmt.Fprintf(writer, "sha256 %s\n", digest)
+	}
+
+	if e.extract == ExtractNone {
+		return e.install(temp, dest, writer)
+	}
+
+	if _, err = temp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var count int
+	switch e.extract {
+	case ExtractTarGz, ExtractTarXz:
+		count, err = e.extractTar(temp, dest)
+	case ExtractZip:
+		count, err = e.extractZip(temp, dest)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(writer, "extracted %d files to %s\n", count, dest)
+
+	return nil
+}
+
+// download writes the body of url to out, reporting progress to writer, and
+// returns the hex sha256 of the body.
+func download(url string, out io.Writer, writer io.Writer) (string, error) {
+	fmt.Fprintf(writer, "downloading %s\n", url)
+
+	response, err := downloadClient.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download failed with %s", response.Status)
+	}
+
+	hash := sha256.New()
+	progress := &downloadProgress{
+		total:  response.ContentLength,
+		writer: writer,
+	}
+
+	size, err := io.Copy(io.MultiWriter(out, hash, progress), response.Body)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(writer, "downloaded %d bytes\n", size)
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// downloadProgress reports every downloadProgressStep percent downloaded
+// when the size is known.
+type downloadProgress struct {
+	total    int64
+	written  int64
+	reported int64
+	writer   io.Writer
+}
+
+func (p *downloadProgress) Write(b []byte) (int, error) {
+	p.written += int64(len(b))
+	if p.total <= 0 {
+		return len(b), nil
+	}
+
+	percent := p.written * 100 / p.total
+	if percent-p.reported >= downloadProgressStep && percent < 100 {
+		p.reported = percent - percent%downloadProgressStep
+		fmt.Fprintf(p.writer, "%d%%\n", p.reported)
+	}
+
+	return len(b), nil
+}
+
+func (e *DownloadEntry) install(
+	temp *os.File,
+	dest string,
+	writer io.Writer,
+) (err error) {
+	mode := e.mode
+	if mode == 0 {
+		mode = 0o644
+	}
+
+	if err = temp.Chmod(mode); err != nil {
+		return err
+	}
+
+	if err = temp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(temp.Name(), dest); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(writer, "wrote %s\n", dest)
+
+	return nil
+}
+
+// extractName strips the leading path components of an archive entry and
+// makes sure it stays inside dest.
+func (e *DownloadEntry) extractName(
+	dest, name string,
+) (extractName string, skip bool, err error) {
+	parts := strings.Split(
+		strings.Trim(filepath.ToSlash(name), "/"),
+		"/",
+	)
+	if len(parts) <= e.stripComponents {
+		return "", true, nil
+	}
+
+	relativeName := filepath.Join(parts[e.stripComponents:]...)
+	if relativeName == "." {
+		return "", true, nil
+	}
+
+	extractName = filepath.Join(dest, relativeName)
+	if !isWithin(dest, extractName) {
+		return "", false, fmt.Errorf("archive entry %s escapes %s", name, dest)
+	}
+
+	return extractName, false, nil
+}
+
+func isWithin(dir, name string) bool {
+	relativeName, err := filepath.Rel(dir, name)
+	return err == nil &&
+		relativeName != ".." &&
+		!strings.HasPrefix(relativeName, ".."+string(os.PathSeparator))
+}
+
+// checkNoLinks makes sure none of the directories between dest and name is
+// a symlink, so an archive can't write outside dest through a link it
+// created earlier.
+func checkNoLinks(dest, name string) error {
+	relativeName, err := filepath.Rel(dest, filepath.Dir(name))
+	if err != nil {
+		return err
+	}
+	if relativeName == "." {
+		return nil
+	}
+
+	dir := dest
+	for _, part := range strings.Split(relativeName, string(os.PathSeparator)) {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf(
+				"archive entry %s writes through the link %s",
+				name,
+				dir,
+			)
+		}
+	}
+
+	return nil
+}
+
+func fileMode(archiveMode os.FileMode) os.FileMode {
+	if archiveMode.Perm() == 0 {
+		return 0o644
+	}
+	return archiveMode.Perm()
+}
+
+func (e *DownloadEntry) extractTar(
+	archive io.Reader,
+	dest string,
+) (count int, err error) {
+	var decompressed io.Reader
+	switch e.extract {
+	case ExtractTarGz:
+		gzipReader, err := gzip.NewReader(archive)
+		if err != nil {
+			return 0, err
+		}
+		defer gzipReader.Close()
+		decompressed = gzipReader
+	case ExtractTarXz:
+		if decompressed, err = xz.NewReader(archive); err != nil {
+			return 0, err
+		}
+	}
+
+	tarReader := tar.NewReader(decompressed)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return count, nil
+		} else if err != nil {
+			return count, err
+		}
+
+		name, skip, err := e.extractName(dest, header.Name)
+		if err != nil {
+			return count, err
+		} else if skip {
+			continue
+		}
+
+		if err = checkNoLinks(dest, name); err != nil {
+			return count, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(name, 0o755)
+		case tar.TypeReg:
+			err = writeExtracted(
+				name,
+				tarReader,
+				fileMode(header.FileInfo().Mode()),
+			)
+			count++
+		case tar.TypeLink:
+			err = e.extractHardLink(dest, name, header)
+			count++
+		case tar.TypeSymlink:
+			target := filepath.Join(filepath.Dir(name), header.Linkname)
+			if filepath.IsAbs(header.Linkname) || !isWithin(dest, target) {
+				return count, fmt.Errorf(
+					"archive link %s escapes %s",
+					header.Name,
+					dest,
+				)
+			}
+			err = writeSymlink(name, header.Linkname)
+			count++
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
+
+// extractHardLink links name to an earlier entry of the archive, which has
+// to be a regular file inside dest.
+func (e *DownloadEntry) extractHardLink(
+	dest, name string,
+	header *tar.Header,
+) error {
+	target, skip, err := e.extractName(dest, header.Linkname)
+	if err != nil {
+		return err
+	} else if skip {
+		return fmt.Errorf(
+			"archive link %s points to the stripped %s",
+			header.Name,
+			header.Linkname,
+		)
+	}
+
+	if err = checkNoLinks(dest, target); err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(target)
+	if err != nil {
+		return err
+	} else if !info.Mode().IsRegular() {
+		return fmt.Errorf(
+			"archive link %s doesn't point to a file",
+			header.Name,
+		)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	if err = os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Link(target, name)
+}
+
+func (e *DownloadEntry) extractZip(
+	archive *os.File,
+	dest string,
+) (count int, err error) {
+	info, err := archive.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	zipReader, err := zip.NewReader(archive, info.Size())
+	if err != nil {
+		return 0, err
+	}
+
+	for _, file := range zipReader.File {
+		name, skip, err := e.extractName(dest, file.Name)
+		if err != nil {
+			return count, err
+		} else if skip {
+			continue
+		}
+
+		if err = checkNoLinks(dest, name); err != nil {
+			return count, err
+		}
+
+		if file.FileInfo().IsDir() {
+			if err = os.MkdirAll(name, 0o755); err != nil {
+				return count, err
+			}
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return count, err
+		}
+
+		err = writeExtracted(name, reader, fileMode(file.Mode()))
+		reader.Close()
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+func writeExtracted(name string, reader io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// removed first so a running binary being replaced keeps working
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(f, reader); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func writeSymlink(name, target string) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Symlink(target, name)
+}
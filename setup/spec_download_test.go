@@ -0,0 +1,263 @@
+package setup
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	body     string
+	mode     int64
+}
+
+func buildTarGz(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+
+	buffer := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, entry := range entries {
+		mode := entry.mode
+		if mode == 0 {
+			mode = 0o644
+		}
+		header := &tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.typeflag,
+			Linkname: entry.linkname,
+			Mode:     mode,
+			Size:     int64(len(entry.body)),
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func buildZip(t *testing.T, names []string) []byte {
+	t.Helper()
+
+	buffer := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(buffer)
+	for _, name := range names {
+		w, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func serve(t *testing.T, body []byte) string {
+	t.Helper()
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Write(body)
+		}),
+	)
+	t.Cleanup(server.Close)
+
+	return server.URL
+}
+
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDownloadExtractTarGz(t *testing.T) {
+	body := buildTarGz(t, []tarEntry{
+		{name: "pkg/", typeflag: tar.TypeDir, mode: 0o755},
+		{
+			name:     "pkg/bin/tool",
+			typeflag: tar.TypeReg,
+			body:     "tool",
+			mode:     0o755,
+		},
+		{name: "pkg/README", typeflag: tar.TypeReg, body: "readme"},
+		{
+			name:     "pkg/bin/alias",
+			typeflag: tar.TypeLink,
+			linkname: "pkg/bin/tool",
+		},
+		{name: "pkg/bin/link", typeflag: tar.TypeSymlink, linkname: "tool"},
+	})
+	dest := filepath.Join(t.TempDir(), "dest")
+
+	entry := &DownloadEntry{
+		url:             serve(t, body),
+		sha256:          digest(body),
+		extract:         ExtractTarGz,
+		stripComponents: 1,
+		dest:            dest,
+	}
+	if err := entry.Run(&setuper{}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dest, "bin", "tool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o755 {
+		t.Errorf("expected tool mode 0755 but got %o", info.Mode().Perm())
+	}
+
+	info, err = os.Stat(filepath.Join(dest, "README"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o644 {
+		t.Errorf("expected README mode 0644 but got %o", info.Mode().Perm())
+	}
+
+	alias, err := os.ReadFile(filepath.Join(dest, "bin", "alias"))
+	if err != nil || string(alias) != "tool" {
+		t.Errorf("expected hard link to tool but got %q, %v", alias, err)
+	}
+
+	target, err := os.Readlink(filepath.Join(dest, "bin", "link"))
+	if err != nil || target != "tool" {
+		t.Errorf("expected symlink to tool but got %q, %v", target, err)
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "file")
+
+	entry := &DownloadEntry{
+		url:    serve(t, []byte("content")),
+		sha256: digest([]byte("other")),
+		dest:   dest,
+	}
+	if err := entry.Run(&setuper{}, io.Discard); err == nil {
+		t.Fatal("expected a sha256 mismatch")
+	}
+
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("expected %s not to be written", dest)
+	}
+}
+
+func TestDownloadRejectsEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{
+			name: "parent path",
+			entries: []tarEntry{
+				{name: "../x", typeflag: tar.TypeReg, body: "x"},
+			},
+		},
+		{
+			name: "absolute symlink",
+			entries: []tarEntry{
+				{name: "a", typeflag: tar.TypeSymlink, linkname: "/tmp"},
+			},
+		},
+		{
+			name: "escaping symlink",
+			entries: []tarEntry{
+				{name: "a", typeflag: tar.TypeSymlink, linkname: "../"},
+				{name: "a/x", typeflag: tar.TypeReg, body: "x"},
+			},
+		},
+		{
+			name: "symlink chain",
+			entries: []tarEntry{
+				{name: "a", typeflag: tar.TypeSymlink, linkname: "."},
+				{name: "a/b", typeflag: tar.TypeSymlink, linkname: ".."},
+				{name: "a/b/x", typeflag: tar.TypeReg, body: "x"},
+			},
+		},
+		{
+			name: "write through symlink",
+			entries: []tarEntry{
+				{name: "sub/", typeflag: tar.TypeDir, mode: 0o755},
+				{name: "a", typeflag: tar.TypeSymlink, linkname: "sub"},
+				{name: "a/x", typeflag: tar.TypeReg, body: "x"},
+			},
+		},
+		{
+			name: "escaping hard link",
+			entries: []tarEntry{
+				{name: "a", typeflag: tar.TypeLink, linkname: "../x"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			dest := filepath.Join(root, "dest")
+			body := buildTarGz(t, test.entries)
+
+			entry := &DownloadEntry{
+				url:     serve(t, body),
+				extract: ExtractTarGz,
+				dest:    dest,
+			}
+			if err := entry.Run(&setuper{}, io.Discard); err == nil {
+				t.Fatal("expected the archive to be rejected")
+			}
+
+			if _, err := os.Lstat(filepath.Join(root, "x")); err == nil {
+				t.Error("expected nothing to be written outside dest")
+			}
+		})
+	}
+}
+
+func TestDownloadZipRejectsParentPath(t *testing.T) {
+	root := t.TempDir()
+	dest := filepath.Join(root, "dest")
+	body := buildZip(t, []string{"ok", "../x"})
+
+	entry := &DownloadEntry{
+		url:     serve(t, body),
+		extract: ExtractZip,
+		dest:    dest,
+	}
+	if err := entry.Run(&setuper{}, io.Discard); err == nil {
+		t.Fatal("expected the archive to be rejected")
+	}
+
+	if _, err := os.Lstat(filepath.Join(root, "x")); err == nil {
+		t.Error("expected nothing to be written outside dest")
+	}
+}
@@ -109,6 +109,8 @@ type Entry struct {
 	ContinueOnError bool
 	RetryCount      int
 	RetryBehavior   RetryBehavior
+	Secrets         map[string]string
+	Remove          string
 	commander       EntryCommander
 }
 
@@ -190,6 +192,16 @@ func (e *Entry) UnmarshalMapDefaults(
 		return err
 	}
 
+	e.Secrets, err = secretsGetDefaultMap(m, "secrets", defaults)
+	if err != nil {
+		return err
+	}
+
+	e.Remove, _, err = parse.StringGetDefaultMap(m, "remove", defaults)
+	if err != nil {
+		return err
+	}
+
 	var commander EntryCommanderUnmarshaler
 	if commander, err = newEntryCommander(e.Type); err != nil {
 		return err
@@ -0,0 +1,164 @@
+package setup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/yo3jones/yconfig/generate"
+	"github.com/yo3jones/yconfig/parse"
+)
+
+type LinkConflict int
+
+const (
+	LinkConflictBackup LinkConflict = iota
+	LinkConflictReplace
+	LinkConflictSkip
+	LinkConflictFail
+)
+
+func LinkConflictFromString(str string) (conflict LinkConflict, err error) {
+	switch str {
+	case "BACKUP":
+		return LinkConflictBackup, nil
+	case "REPLACE":
+		return LinkConflictReplace, nil
+	case "SKIP":
+		return LinkConflictSkip, nil
+	case "FAIL":
+		return LinkConflictFail, nil
+	}
+	return conflict, fmt.Errorf("unknown LinkConflict for string %s", str)
+}
+
+func (conflict LinkConflict) String() string {
+	switch conflict {
+	case LinkConflictBackup:
+		return "BACKUP"
+	case LinkConflictReplace:
+		return "REPLACE"
+	case LinkConflictSkip:
+		return "SKIP"
+	case LinkConflictFail:
+		return "FAIL"
+	}
+
+	return "UNKNOWN"
+}
+
+// LinkEntry links dest to src. When something other than the link is already
+// at dest the conflict policy decides whether it is backed up like generate
+// does, replaced, left alone or fails the entry.
+type LinkEntry struct {
+	src      string
+	dest     string
+	conflict LinkConflict
+}
+
+func (e *LinkEntry) unmarshalMapDefaults(
+	m, defaults *map[string]any,
+) (err error) {
+	var exists bool
+
+	e.src, exists, err = parse.StringGetDefaultMap(m, "src", defaults)
+	if err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("link setup entry requires field src")
+	}
+
+	e.dest, exists, err = parse.StringGetDefaultMap(m, "dest", defaults)
+	if err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("link setup entry requires field dest")
+	}
+
+	var conflict string
+	conflict, exists, err = parse.StringGetDefaultMap(m, "conflict", defaults)
+	if err != nil {
+		return err
+	} else if exists {
+		if e.conflict, err = LinkConflictFromString(conflict); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *LinkEntry) BuildCommand(
+	system System,
+) (cmd string, args []string, err error) {
+	return "ln", []string{"-s", e.src, e.dest}, nil
+}
+
+func (e *LinkEntry) Run(system System, writer io.Writer) (err error) {
+	src, err := filepath.Abs(system.Path(e.src))
+	if err != nil {
+		return err
+	}
+
+	dest := system.Path(e.dest)
+
+	if target, err := os.Readlink(dest); err == nil && target == src {
+		fmt.Fprintf(writer, "%s already links to %s\n", dest, src)
+		return nil
+	}
+
+	if info, err := os.Lstat(dest); err == nil {
+		if err = e.resolveConflict(dest, info, writer); err != nil {
+			return err
+		}
+		if e.conflict == LinkConflictSkip && info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+
+	if err = os.Symlink(src, dest); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(writer, "linked %s to %s\n", dest, src)
+
+	return nil
+}
+
+// resolveConflict clears dest for the link. Other links are always replaced.
+func (e *LinkEntry) resolveConflict(
+	dest string,
+	info os.FileInfo,
+	writer io.Writer,
+) error {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return os.Remove(dest)
+	}
+
+	switch e.conflict {
+	case LinkConflictReplace:
+		fmt.Fprintf(writer, "replacing %s\n", dest)
+		return os.RemoveAll(dest)
+	case LinkConflictSkip:
+		fmt.Fprintf(writer, "skipping %s, it already exists\n", dest)
+		return nil
+	case LinkConflictFail:
+		return fmt.Errorf("%s already exists", dest)
+	}
+
+	backupName, err := generate.BackupName(dest)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(writer, "moving %s to %s\n", dest, backupName)
+
+	return os.Rename(dest, backupName)
+}
@@ -0,0 +1,145 @@
+package setup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/yo3jones/yconfig/parse"
+)
+
+// Package is one package of a package entry, optionally pinned to a version
+// and passed extra flags.
+type Package struct {
+	Name    string
+	Version string
+	Flags   []string
+}
+
+// packageCommand is what the script of a package manager is rendered with
+// when it is a template.
+type packageCommand struct {
+	Packages string
+	Flags    string
+}
+
+func packagesGetDefaultMap(
+	m *map[string]any,
+	key string,
+	defaults *map[string]any,
+) (packages []*Package, err error) {
+	raw, exists, err := parse.GetDefaultMap[any](m, key, defaults)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	switch raw := (*raw).(type) {
+	case string:
+		return []*Package{{Name: raw}}, nil
+	case []any:
+		packages = make([]*Package, len(raw))
+		for i, item := range raw {
+			if packages[i], err = unmarshalPackage(item); err != nil {
+				return nil, err
+			}
+		}
+		return packages, nil
+	}
+
+	return nil, fmt.Errorf(
+		"packages must be either a string or a list but got %T",
+		*raw,
+	)
+}
+
+func unmarshalPackage(raw any) (pkg *Package, err error) {
+	switch raw := raw.(type) {
+	case string:
+		return &Package{Name: raw}, nil
+	case map[string]any:
+		pkg = &Package{}
+		var exists bool
+		if pkg.Name, exists, err = parse.StringGet(&raw, "name"); err != nil {
+			return nil, err
+		} else if !exists {
+			return nil, fmt.Errorf("package requires field name")
+		}
+		if pkg.Version, err = packageVersionGet(&raw); err != nil {
+			return nil, err
+		}
+		if pkg.Flags, _, err = parse.StringSliceGet(&raw, "flags"); err != nil {
+			return nil, err
+		}
+		return pkg, nil
+	}
+
+	return nil, fmt.Errorf(
+		"package must be either a string or map[string]any but got %T",
+		raw,
+	)
+}
+
+// packageVersionGet reads the version of a package, which yaml decodes as a
+// number when it isn't quoted.
+func packageVersionGet(m *map[string]any) (string, error) {
+	switch version := (*m)["version"].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return version, nil
+	case int:
+		return strconv.Itoa(version), nil
+	case float64:
+		return strconv.FormatFloat(version, 'f', -1, 64), nil
+	}
+
+	return "", fmt.Errorf(
+		"package version must be a string or a number but got %T",
+		(*m)["version"],
+	)
+}
+
+// parsePackageTemplate parses a package manager template and renders it once
+// with placeholder data so unknown fields fail when loading the config.
+func parsePackageTemplate(
+	name, text string,
+	data any,
+) (*template.Template, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = t.Execute(&strings.Builder{}, data); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func renderPackageTemplate(t *template.Template, data any) (string, error) {
+	sb := &strings.Builder{}
+	if err := t.Execute(sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func hasPackageVersions(packages []*Package) bool {
+	for _, pkg := range packages {
+		if pkg.Version != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPackageFlags(packages []*Package) bool {
+	for _, pkg := range packages {
+		if len(pkg.Flags) > 0 {
+			return true
+		}
+	}
+	return false
+}
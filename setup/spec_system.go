@@ -3,24 +3,42 @@ package setup
 import (
 	"fmt"
 	"strings"
+	"text/template"
+	"unicode"
 
 	"github.com/yo3jones/yconfig/archtypes"
+	"github.com/yo3jones/yconfig/generate"
 	"github.com/yo3jones/yconfig/ostypes"
 	"github.com/yo3jones/yconfig/parse"
 	"github.com/yo3jones/yconfig/set"
 )
 
 type System interface {
-	PackageManager() *SystemPackageManager
+	PackageManager(name string) *SystemPackageManager
 	Script() *SystemScript
+	Platform() (os, arch string)
+	Path(name string) string
+	SetupMode() Mode
+	NewGenerator() (generate.Generator, error)
 }
 
 type SystemPackageManager struct {
-	Os           ostypes.Os
-	Arch         archtypes.Arch
-	Tags         *set.Set[string]
-	RequiredTags *set.Set[string]
-	Script       string
+	Name          string
+	Os            ostypes.Os
+	Arch          archtypes.Arch
+	Tags          *set.Set[string]
+	RequiredTags  *set.Set[string]
+	Script        string
+	CheckScript   string
+	ListScript    string
+	UpgradeScript string
+	RemoveScript  string
+	TapScript     string
+	PackageFormat string
+	Batch         bool
+	format        *template.Template
+	check         *template.Template
+	templates     map[Mode]*template.Template
 }
 
 func UnmarshalSystemPackageManagers(
@@ -64,20 +82,151 @@ func (pm *SystemPackageManager) GetRequiredTags() *set.Set[string] {
 	return pm.RequiredTags
 }
 
+// ModeScript is the script of the package manager for the mode, empty when
+// it has none.
+func (pm *SystemPackageManager) ModeScript(mode Mode) string {
+	switch mode {
+	case ModeUpgrade:
+		return pm.UpgradeScript
+	case ModeRemove:
+		return pm.RemoveScript
+	}
+	return pm.Script
+}
+
+// BuildCommand builds the command running the script of the mode for the
+// packages. A script that is a template is rendered with the formatted
+// packages and the flags, otherwise both are appended to it. Packages with
+// different flags are passed in separate invocations.
 func (pm *SystemPackageManager) BuildCommand(
 	script *SystemScript,
-	packages []string,
+	mode Mode,
+	packages []*Package,
+) (cmd string, args []string, err error) {
+	flagGroups := []string{}
+	grouped := map[string][]string{}
+	for _, pkg := range packages {
+		var formatted string
+		if formatted, err = pm.FormatPackage(pkg); err != nil {
+			return "", nil, err
+		}
+		flags := strings.Join(pkg.Flags, " ")
+		if _, ok := grouped[flags]; !ok {
+			flagGroups = append(flagGroups, flags)
+		}
+		grouped[flags] = append(grouped[flags], shellQuote(formatted))
+	}
+
+	if len(flagGroups) == 0 {
+		flagGroups = append(flagGroups, "")
+	}
+
+	pmScripts := make([]string, len(flagGroups))
+	for i, flags := range flagGroups {
+		pmScripts[i], err = pm.renderScript(mode, flags, grouped[flags])
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	cmd, args = script.BuildCommand(strings.Join(pmScripts, " && \\\n"))
+
+	return cmd, args, nil
+}
+
+func (pm *SystemPackageManager) renderScript(
+	mode Mode,
+	flags string,
+	formatted []string,
+) (string, error) {
+	if t, ok := pm.templates[mode]; ok {
+		return renderPackageTemplate(t, &packageCommand{
+			Packages: strings.Join(formatted, " "),
+			Flags:    flags,
+		})
+	}
+
+	pmScriptParts := make([]string, 0, len(formatted)+2)
+	pmScriptParts = append(pmScriptParts, pm.ModeScript(mode))
+	if flags != "" {
+		pmScriptParts = append(pmScriptParts, flags)
+	}
+	pmScriptParts = append(pmScriptParts, formatted...)
+
+	return strings.Join(pmScriptParts, " "), nil
+}
+
+// FormatPackage formats a package pinned to a version with the package
+// format of the package manager. Unpinned packages are just their name.
+func (pm *SystemPackageManager) FormatPackage(pkg *Package) (string, error) {
+	if pm.format == nil || pkg.Version == "" {
+		return pkg.Name, nil
+	}
+
+	formatted, err := renderPackageTemplate(pm.format, pkg)
+	if err != nil {
+		return "", fmt.Errorf("formatting package %s: %w", pkg.Name, err)
+	}
+
+	return formatted, nil
+}
+
+// shellQuote quotes a package for the system script unless the shell passes
+// it through as is, so pins like python3=3.11.* aren't expanded as globs.
+func shellQuote(word string) string {
+	if word != "" && strings.IndexFunc(word, isShellSpecial) < 0 {
+		return word
+	}
+
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+func isShellSpecial(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) &&
+		!strings.ContainsRune("@%+=:,./_-", r)
+}
+
+// BuildTapCommand builds the command adding the taps of a Brewfile, one tap
+// script invocation per tap.
+func (pm *SystemPackageManager) BuildTapCommand(
+	script *SystemScript,
+	taps []string,
 ) (cmd string, args []string) {
-	pmScriptParts := make([]string, 0, len(packages)+1)
-	pmScriptParts = append(pmScriptParts, pm.Script)
-	pmScriptParts = append(pmScriptParts, packages...)
+	tapScripts := make([]string, len(taps))
+	for i, tap := range taps {
+		tapScripts[i] = fmt.Sprintf("%s %s", pm.TapScript, shellQuote(tap))
+	}
+	return script.BuildCommand(strings.Join(tapScripts, " && \\\n"))
+}
+
+// BuildCheckCommand builds the command checking whether a package is already
+// installed, which exits zero when it is. A check script that is a template
+// is rendered with the package, so it can compare the pinned version,
+// otherwise the package name is appended to it.
+func (pm *SystemPackageManager) BuildCheckCommand(
+	script *SystemScript,
+	pkg *Package,
+) (cmd string, args []string, err error) {
+	checkScript := fmt.Sprintf("%s %s", pm.CheckScript, shellQuote(pkg.Name))
+	if pm.check != nil {
+		if checkScript, err = renderPackageTemplate(pm.check, pkg); err != nil {
+			return "", nil, fmt.Errorf(
+				"checking package %s: %w",
+				pkg.Name,
+				err,
+			)
+		}
+	}
 
-	pmScript := strings.Join(pmScriptParts, " ")
+	cmd, args = script.BuildCommand(checkScript)
 
-	return script.BuildCommand(pmScript)
+	return cmd, args, nil
 }
 
 func (pm *SystemPackageManager) UnmarshalMap(m *map[string]any) (err error) {
+	if pm.Name, _, err = parse.StringGet(m, "name"); err != nil {
+		return err
+	}
 	if pm.Os, _, err = parse.OsGet(m, "os"); err != nil {
 		return err
 	}
@@ -92,6 +241,86 @@ func (pm *SystemPackageManager) UnmarshalMap(m *map[string]any) (err error) {
 		return err
 	}
 	pm.Script = *script
+	if pm.CheckScript, _, err = parse.StringGet(m, "checkScript"); err != nil {
+		return err
+	}
+	if pm.ListScript, _, err = parse.StringGet(m, "listScript"); err != nil {
+		return err
+	}
+	pm.UpgradeScript, _, err = parse.StringGet(m, "upgradeScript")
+	if err != nil {
+		return err
+	}
+	pm.RemoveScript, _, err = parse.StringGet(m, "removeScript")
+	if err != nil {
+		return err
+	}
+	if pm.TapScript, _, err = parse.StringGet(m, "tapScript"); err != nil {
+		return err
+	}
+	pm.PackageFormat, _, err = parse.StringGet(m, "packageFormat")
+	if err != nil {
+		return err
+	}
+	var batch *bool
+	if batch, _, err = parse.Get[bool](m, "batch"); err != nil {
+		return err
+	}
+	pm.Batch = batch != nil && *batch
+	return pm.parseTemplates()
+}
+
+// parseTemplates parses the package format and the scripts that are
+// templates.
+func (pm *SystemPackageManager) parseTemplates() (err error) {
+	examplePackage := &Package{
+		Name:    "name",
+		Version: "version",
+		Flags:   []string{},
+	}
+
+	if pm.PackageFormat != "" {
+		pm.format, err = parsePackageTemplate(
+			"packageFormat",
+			pm.PackageFormat,
+			examplePackage,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if strings.Contains(pm.CheckScript, "{{") {
+		pm.check, err = parsePackageTemplate(
+			"checkScript",
+			pm.CheckScript,
+			examplePackage,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	pm.templates = map[Mode]*template.Template{}
+	for _, mode := range []Mode{ModeInstall, ModeUpgrade, ModeRemove} {
+		text := pm.ModeScript(mode)
+		if !strings.Contains(text, "{{") {
+			continue
+		}
+		name := "script"
+		if mode != ModeInstall {
+			name = fmt.Sprintf("%sScript", mode)
+		}
+		pm.templates[mode], err = parsePackageTemplate(
+			name,
+			text,
+			&packageCommand{},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -0,0 +1,70 @@
+package setup
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/yo3jones/yconfig/generate"
+	"github.com/yo3jones/yconfig/parse"
+)
+
+// TemplateEntry renders the templates matching the globs with the generate
+// engine, using the generate config, so dotfiles can be set up between other
+// entries.
+type TemplateEntry struct {
+	templates []string
+}
+
+func (e *TemplateEntry) unmarshalMapDefaults(
+	m, defaults *map[string]any,
+) (err error) {
+	var exists bool
+
+	e.templates, exists, err = parse.StringSliceGetDefaultMap(
+		m,
+		"templates",
+		defaults,
+	)
+	if err != nil {
+		return err
+	} else if !exists || len(e.templates) == 0 {
+		return fmt.Errorf("template setup entry requires field templates")
+	}
+
+	return nil
+}
+
+func (e *TemplateEntry) BuildCommand(
+	system System,
+) (cmd string, args []string, err error) {
+	return "generate", e.templates, nil
+}
+
+func (e *TemplateEntry) Run(system System, writer io.Writer) (err error) {
+	generator, err := system.NewGenerator()
+	if err != nil {
+		return err
+	}
+
+	reported := map[string]bool{}
+
+	return generator.
+		Include(e.templates).
+		OnProgress(func(progress *generate.Progress) {
+			for _, p := range progress.TemplatesProgress {
+				if reported[p.Path] {
+					continue
+				}
+				switch p.Status {
+				case generate.Complete:
+					fmt.Fprintf(writer, "generated %s\n", p.Path)
+				case generate.Error:
+					fmt.Fprintln(writer, p.Err)
+				default:
+					continue
+				}
+				reported[p.Path] = true
+			}
+		}).
+		Generate()
+}
@@ -22,7 +22,7 @@ var (
 	statusStyle = lipgloss.NewStyle().
 			PaddingLeft(1).
 			PaddingRight(1).
-			Width(10)
+			Width(11)
 
 	viewportStyle = lipgloss.NewStyle().
 			MarginLeft(5).
@@ -169,6 +169,8 @@ func (m *ValueModel) getStatusStyle() lipgloss.Style {
 		}
 	case StatusError:
 		style.Foreground(lipgloss.Color("1"))
+	case StatusSatisfied:
+		style.Foreground(lipgloss.Color("6"))
 	}
 
 	return style
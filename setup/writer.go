@@ -1,21 +1,51 @@
 package setup
 
-import "io"
+import (
+	"bytes"
+	"io"
+)
+
+const (
+	redacted = "********"
+
+	// shorter values like yes or 1 would mangle ordinary output
+	minRedactLength = 6
+)
 
 type setupWriter struct {
 	buffer     *[]byte
+	redact     [][]byte
 	onProgress func()
 }
 
 func (w *setupWriter) Write(p []byte) (n int, err error) {
 	*w.buffer = append(*w.buffer, p...)
+	// redacting the whole buffer catches secrets split across writes
+	for _, value := range w.redact {
+		*w.buffer = bytes.ReplaceAll(*w.buffer, value, []byte(redacted))
+	}
 	w.onProgress()
 	return len(p), nil
 }
 
-func NewWriter(out *[]byte, onProgress func()) (writer io.Writer) {
+// NewWriter appends everything written to out, replacing any of the redact
+// values of at least minRedactLength so secrets never end up in the entry
+// output.
+func NewWriter(
+	out *[]byte,
+	redact []string,
+	onProgress func(),
+) (writer io.Writer) {
+	redactBytes := make([][]byte, 0, len(redact))
+	for _, value := range redact {
+		if len(value) >= minRedactLength {
+			redactBytes = append(redactBytes, []byte(value))
+		}
+	}
+
 	return &setupWriter{
 		buffer:     out,
+		redact:     redactBytes,
 		onProgress: onProgress,
 	}
 }
@@ -0,0 +1,183 @@
+package source
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	refSeparator  = "@"
+	cacheDirName  = "yconfig"
+	sourceDirName = "sources"
+	defaultRemote = "origin"
+)
+
+// Git clones or updates a git repository into the users cache dir and checks
+// out the requested ref so its config and templates can be used in place.
+type Git struct {
+	Url string
+	Ref string
+}
+
+// ParseGit parses a source given as `<url>[@ref]`. The ref is split at the
+// last @ in the path of the url, so the user of urls such as
+// ssh://git@host/repo.git or git@github.com:user/repo.git is kept and refs
+// may contain slashes like release/1.0.
+func ParseGit(spec string) *Git {
+	start := pathStart(spec)
+	i := strings.LastIndex(spec[start:], refSeparator)
+	if i < 0 {
+		return &Git{Url: spec}
+	}
+
+	url, ref := spec[:start+i], spec[start+i+len(refSeparator):]
+	if url == "" || ref == "" {
+		return &Git{Url: spec}
+	}
+
+	return &Git{Url: url, Ref: ref}
+}
+
+// pathStart is where the path of a url starts, after the scheme, user and
+// host. Scp like urls such as git@github.com:user/repo.git have a : before
+// any / and local paths start right away.
+func pathStart(spec string) int {
+	if i := strings.Index(spec, "://"); i >= 0 {
+		host := i + len("://")
+		if j := strings.Index(spec[host:], "/"); j >= 0 {
+			return host + j
+		}
+		return len(spec)
+	}
+
+	colon := strings.Index(spec, ":")
+	slash := strings.Index(spec, "/")
+	if colon >= 0 && (slash < 0 || colon < slash) {
+		return colon + 1
+	}
+
+	return 0
+}
+
+// Dir is the cache dir the repository is checked out to.
+func (g *Git) Dir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(g.Url))
+
+	return filepath.Join(
+		cacheDir,
+		cacheDirName,
+		sourceDirName,
+		hex.EncodeToString(sum[:])[:16],
+	), nil
+}
+
+// Fetch clones or updates the repository and checks out the ref, or the
+// remote default branch when no ref is given. The checked out dir and commit
+// are returned and git output is written to writer.
+func (g *Git) Fetch(writer io.Writer) (dir, commit string, err error) {
+	if dir, err = g.Dir(); err != nil {
+		return "", "", err
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if err = os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+			return "", "", err
+		}
+		err = git(writer, "", "clone", "--no-checkout", g.Url, dir)
+		if err != nil {
+			return "", "", err
+		}
+	} else if err != nil {
+		return "", "", err
+	} else {
+		err = git(
+			writer,
+			dir,
+			"fetch",
+			"--tags",
+			"--prune",
+			"--force",
+			defaultRemote,
+		)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	if commit, err = g.resolve(dir); err != nil {
+		return "", "", err
+	}
+
+	err = git(writer, dir, "checkout", "--quiet", "--force", "--detach", commit)
+	if err != nil {
+		return "", "", err
+	}
+
+	return dir, commit, nil
+}
+
+// resolve prefers the remote branch of the ref so updated branches are picked
+// up, then falls back to tags and commits.
+func (g *Git) resolve(dir string) (string, error) {
+	candidates := []string{defaultRemote + "/HEAD"}
+	if g.Ref != "" {
+		candidates = []string{defaultRemote + "/" + g.Ref, g.Ref}
+	}
+
+	for _, candidate := range candidates {
+		commit, err := gitOutput(
+			dir,
+			"rev-parse",
+			"--verify",
+			"--quiet",
+			candidate+"^{commit}",
+		)
+		if err == nil {
+			return commit, nil
+		}
+	}
+
+	if g.Ref == "" {
+		return "", fmt.Errorf("unable to resolve default branch of %s", g.Url)
+	}
+
+	return "", fmt.Errorf("unable to resolve ref %s of %s", g.Ref, g.Url)
+}
+
+func git(writer io.Writer, dir string, args ...string) error {
+	command := exec.Command("git", args...)
+	command.Dir = dir
+	command.Stdout = writer
+	command.Stderr = writer
+
+	if err := command.Run(); err != nil {
+		return fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+
+	return nil
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	command := exec.Command("git", args...)
+	command.Dir = dir
+	command.Stdout = out
+
+	if err := command.Run(); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(out.String()), nil
+}
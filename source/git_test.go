@@ -0,0 +1,136 @@
+package source
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseGit(t *testing.T) {
+	tests := []struct {
+		spec string
+		url  string
+		ref  string
+	}{
+		{
+			spec: "https://github.com/user/repo.git",
+			url:  "https://github.com/user/repo.git",
+		},
+		{
+			spec: "https://github.com/user/repo.git@v1.0",
+			url:  "https://github.com/user/repo.git",
+			ref:  "v1.0",
+		},
+		{
+			spec: "https://github.com/user/repo.git@release/1.0",
+			url:  "https://github.com/user/repo.git",
+			ref:  "release/1.0",
+		},
+		{
+			spec: "ssh://git@host/repo.git",
+			url:  "ssh://git@host/repo.git",
+		},
+		{
+			spec: "ssh://git@host/repo.git@release/1.0",
+			url:  "ssh://git@host/repo.git",
+			ref:  "release/1.0",
+		},
+		{
+			spec: "git@github.com:user/repo.git",
+			url:  "git@github.com:user/repo.git",
+		},
+		{
+			spec: "git@github.com:user/repo.git@release/1.0",
+			url:  "git@github.com:user/repo.git",
+			ref:  "release/1.0",
+		},
+		{
+			spec: "/srv/repo.git@release/1.0",
+			url:  "/srv/repo.git",
+			ref:  "release/1.0",
+		},
+		{
+			spec: "/srv/repo.git@",
+			url:  "/srv/repo.git@",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			git := ParseGit(test.spec)
+			if git.Url != test.url || git.Ref != test.ref {
+				t.Errorf(
+					"expected url %q and ref %q but got %q and %q",
+					test.url,
+					test.ref,
+					git.Url,
+					git.Ref,
+				)
+			}
+		})
+	}
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	command := exec.Command("git", args...)
+	command.Dir = dir
+	if out, err := command.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestFetchSlashedBranch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	root := t.TempDir()
+	t.Setenv("HOME", root)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(root, "cache"))
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	bare := filepath.Join(root, "repo.git")
+	work := filepath.Join(root, "work")
+	runGit(t, root, "init", "--quiet", "--bare", bare)
+	runGit(t, root, "clone", "--quiet", bare, work)
+
+	name := filepath.Join(work, ".yconfig.yaml")
+	if err := os.WriteFile(name, []byte("main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, work, "add", ".")
+	runGit(t, work, "commit", "--quiet", "-m", "main")
+	runGit(t, work, "push", "--quiet", "origin", "HEAD")
+
+	runGit(t, work, "checkout", "--quiet", "-b", "release/1.0")
+	if err := os.WriteFile(name, []byte("release\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, work, "commit", "--quiet", "-am", "release")
+	runGit(t, work, "push", "--quiet", "origin", "release/1.0")
+
+	git := ParseGit(bare + "@release/1.0")
+	if git.Url != bare || git.Ref != "release/1.0" {
+		t.Fatalf("expected %s at release/1.0 but got %+v", bare, git)
+	}
+
+	dir, _, err := git.Fetch(io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, ".yconfig.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "release\n" {
+		t.Errorf("expected the release branch but got %q", content)
+	}
+}